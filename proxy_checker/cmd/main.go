@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"os"
 	"os/signal"
 	"syscall"
 
@@ -12,13 +13,30 @@ import (
 	"github.com/moroshma/proxy_checker/proxy_checker/internal/logger"
 )
 
+const usage = `usage: proxy_checker [serve|worker|all]
+
+  serve   только HTTP API
+  worker  только чекер очереди
+  all     API и чекер в одном процессе (по умолчанию)
+`
+
 func main() {
+	var arg string
+	if len(os.Args) > 1 {
+		arg = os.Args[1]
+	}
+	mode, err := app.ParseMode(arg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n\n%s", err, usage)
+		os.Exit(2)
+	}
+
 	cfg := config.MustLoad()
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
 	logger.New(cfg.Logger.Level)
-	err := app.Run(ctx, cfg)
+	err = app.Run(ctx, cfg, mode)
 	if err != nil {
 		slog.Error(fmt.Sprintf("error: %v", err))
 	}
@@ -0,0 +1 @@
+ALTER TABLE proxy_metric ALTER COLUMN speed TYPE integer;
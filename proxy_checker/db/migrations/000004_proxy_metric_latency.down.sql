@@ -0,0 +1,4 @@
+ALTER TABLE proxy_metric DROP COLUMN connect_ms;
+ALTER TABLE proxy_metric DROP COLUMN handshake_ms;
+ALTER TABLE proxy_metric DROP COLUMN tls_ms;
+ALTER TABLE proxy_metric DROP COLUMN ttfb_ms;
@@ -0,0 +1,4 @@
+ALTER TABLE proxy_metric ADD COLUMN connect_ms integer;
+ALTER TABLE proxy_metric ADD COLUMN handshake_ms integer;
+ALTER TABLE proxy_metric ADD COLUMN tls_ms integer;
+ALTER TABLE proxy_metric ADD COLUMN ttfb_ms integer;
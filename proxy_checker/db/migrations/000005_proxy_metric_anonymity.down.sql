@@ -0,0 +1,2 @@
+ALTER TABLE proxy_metric DROP COLUMN anonymity;
+ALTER TABLE proxy_metric DROP COLUMN leaked_headers;
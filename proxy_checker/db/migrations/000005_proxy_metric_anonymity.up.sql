@@ -0,0 +1,2 @@
+ALTER TABLE proxy_metric ADD COLUMN anonymity varchar(32);
+ALTER TABLE proxy_metric ADD COLUMN leaked_headers text[];
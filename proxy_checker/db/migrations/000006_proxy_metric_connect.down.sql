@@ -0,0 +1,2 @@
+ALTER TABLE proxy_metric DROP COLUMN connect_allowed;
+ALTER TABLE proxy_metric DROP COLUMN allowed_ports;
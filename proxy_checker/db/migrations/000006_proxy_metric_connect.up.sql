@@ -0,0 +1,2 @@
+ALTER TABLE proxy_metric ADD COLUMN connect_allowed boolean;
+ALTER TABLE proxy_metric ADD COLUMN allowed_ports integer[];
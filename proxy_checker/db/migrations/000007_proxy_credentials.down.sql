@@ -0,0 +1,2 @@
+ALTER TABLE proxy DROP COLUMN credentials;
+ALTER TABLE proxy_metric DROP COLUMN fail_reason;
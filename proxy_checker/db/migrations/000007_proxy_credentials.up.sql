@@ -0,0 +1,2 @@
+ALTER TABLE proxy ADD COLUMN credentials bytea;
+ALTER TABLE proxy_metric ADD COLUMN fail_reason varchar(64);
@@ -0,0 +1,2 @@
+ALTER TABLE proxy DROP COLUMN host;
+ALTER TABLE proxy DROP COLUMN resolved_ips;
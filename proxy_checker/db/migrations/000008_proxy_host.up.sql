@@ -0,0 +1,3 @@
+ALTER TABLE proxy ADD COLUMN host varchar(255);
+ALTER TABLE proxy ADD COLUMN resolved_ips inet[];
+UPDATE proxy SET host = host(ip);
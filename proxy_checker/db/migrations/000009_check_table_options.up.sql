@@ -0,0 +1 @@
+ALTER TABLE check_table ADD COLUMN options jsonb;
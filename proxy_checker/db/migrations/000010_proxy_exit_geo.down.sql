@@ -0,0 +1,2 @@
+ALTER TABLE proxy DROP COLUMN exit_city;
+ALTER TABLE proxy DROP COLUMN geo_mismatch;
@@ -0,0 +1,2 @@
+ALTER TABLE proxy ADD COLUMN exit_city varchar(255);
+ALTER TABLE proxy ADD COLUMN geo_mismatch boolean;
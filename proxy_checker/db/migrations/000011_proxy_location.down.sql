@@ -0,0 +1,14 @@
+ALTER TABLE proxy ADD COLUMN city varchar(255);
+ALTER TABLE proxy ADD COLUMN exit_city varchar(255);
+
+UPDATE proxy px
+SET city = concat_ws(', ', pl.country, pl.city)
+FROM proxy_location pl
+WHERE pl.proxy_id = px.proxy_id AND pl.kind = 'entry';
+
+UPDATE proxy px
+SET exit_city = concat_ws(', ', pl.country, pl.city)
+FROM proxy_location pl
+WHERE pl.proxy_id = px.proxy_id AND pl.kind = 'exit';
+
+DROP TABLE proxy_location;
@@ -0,0 +1,36 @@
+CREATE TABLE IF NOT EXISTS proxy_location
+(
+    proxy_id     UUID REFERENCES proxy (proxy_id),
+    kind         varchar(16),
+    ip           inet,
+    country      varchar(255),
+    country_code varchar(2),
+    region       varchar(16),
+    region_name  varchar(255),
+    city         varchar(255),
+    zip          varchar(32),
+    lat          double precision,
+    lon          double precision,
+    timezone     varchar(64),
+    isp          varchar(255),
+    org          varchar(255),
+    asn          integer,
+    as_name      varchar(255),
+    PRIMARY KEY (proxy_id, kind)
+);
+
+CREATE INDEX IF NOT EXISTS proxy_location_country_code_idx ON proxy_location (country_code);
+CREATE INDEX IF NOT EXISTS proxy_location_asn_idx ON proxy_location (asn);
+
+INSERT INTO proxy_location (proxy_id, kind, ip, country, city)
+SELECT proxy_id, 'entry', ip, NULLIF(split_part(city, ', ', 1), ''), NULLIF(split_part(city, ', ', 2), '')
+FROM proxy
+WHERE city IS NOT NULL AND city <> ', ';
+
+INSERT INTO proxy_location (proxy_id, kind, ip, country, city)
+SELECT proxy_id, 'exit', real_ip, NULLIF(split_part(exit_city, ', ', 1), ''), NULLIF(split_part(exit_city, ', ', 2), '')
+FROM proxy
+WHERE exit_city IS NOT NULL AND exit_city <> ', ';
+
+ALTER TABLE proxy DROP COLUMN city;
+ALTER TABLE proxy DROP COLUMN exit_city;
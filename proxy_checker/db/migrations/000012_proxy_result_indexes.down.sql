@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS proxy_metric_check_id_is_work_idx;
+DROP INDEX IF EXISTS proxy_metric_proxy_id_idx;
+DROP INDEX IF EXISTS proxy_check_id_idx;
@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS proxy_check_id_idx ON proxy (check_id);
+CREATE INDEX IF NOT EXISTS proxy_metric_proxy_id_idx ON proxy_metric (proxy_id);
+CREATE INDEX IF NOT EXISTS proxy_metric_check_id_is_work_idx ON proxy_metric (check_id, is_work);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS check_table_create_at_idx;
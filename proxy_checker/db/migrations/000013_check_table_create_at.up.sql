@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS check_table_create_at_idx ON check_table (create_at DESC, check_id DESC);
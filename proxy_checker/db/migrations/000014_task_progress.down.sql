@@ -0,0 +1,2 @@
+ALTER TABLE proxy_metric DROP COLUMN checked_at;
+ALTER TABLE check_table DROP COLUMN started_at;
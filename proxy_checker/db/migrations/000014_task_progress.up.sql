@@ -0,0 +1,2 @@
+ALTER TABLE check_table ADD COLUMN started_at timestamp;
+ALTER TABLE proxy_metric ADD COLUMN checked_at timestamp;
@@ -0,0 +1 @@
+ALTER TABLE check_table DROP COLUMN finished_at;
@@ -0,0 +1,5 @@
+ALTER TABLE check_table ADD COLUMN finished_at timestamp;
+
+UPDATE check_table ct
+SET finished_at = (SELECT max(checked_at) FROM proxy_metric pm WHERE pm.check_id = ct.check_id)
+WHERE NOT EXISTS (SELECT 1 FROM proxy_metric pm WHERE pm.check_id = ct.check_id AND pm.status = 'pending');
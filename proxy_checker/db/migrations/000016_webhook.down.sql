@@ -0,0 +1,4 @@
+DROP TABLE webhook_attempt;
+
+ALTER TABLE check_table DROP COLUMN callback_secret;
+ALTER TABLE check_table DROP COLUMN callback_url;
@@ -0,0 +1,16 @@
+ALTER TABLE check_table ADD COLUMN callback_url text;
+ALTER TABLE check_table ADD COLUMN callback_secret bytea;
+
+CREATE TABLE IF NOT EXISTS webhook_attempt
+(
+    attempt_id  UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    check_id    UUID REFERENCES check_table (check_id),
+    attempt     int,
+    url         text,
+    status_code int,
+    error       text,
+    duration_ms int,
+    create_at   timestamp        DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_attempt_check_id_idx ON webhook_attempt (check_id);
@@ -0,0 +1,3 @@
+UPDATE proxy_metric SET status = 'pending' WHERE status = 'cancelled';
+
+ALTER TABLE check_table DROP COLUMN cancelled_at;
@@ -0,0 +1 @@
+ALTER TABLE check_table ADD COLUMN cancelled_at timestamp;
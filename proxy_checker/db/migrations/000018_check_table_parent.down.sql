@@ -0,0 +1 @@
+ALTER TABLE check_table DROP COLUMN parent_check_id;
@@ -0,0 +1,3 @@
+ALTER TABLE check_table ADD COLUMN parent_check_id UUID REFERENCES check_table (check_id);
+
+CREATE INDEX IF NOT EXISTS check_table_parent_check_id_idx ON check_table (parent_check_id);
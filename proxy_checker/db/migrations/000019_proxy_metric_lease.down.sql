@@ -0,0 +1,7 @@
+UPDATE proxy_metric SET status = 'pending' WHERE status = 'in_progress';
+
+DROP INDEX IF EXISTS proxy_metric_in_progress_idx;
+DROP INDEX IF EXISTS proxy_metric_pending_idx;
+
+ALTER TABLE proxy_metric DROP COLUMN lease_until;
+ALTER TABLE proxy_metric DROP COLUMN worker_id;
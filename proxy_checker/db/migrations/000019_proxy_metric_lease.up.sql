@@ -0,0 +1,5 @@
+ALTER TABLE proxy_metric ADD COLUMN worker_id varchar(255);
+ALTER TABLE proxy_metric ADD COLUMN lease_until timestamp;
+
+CREATE INDEX IF NOT EXISTS proxy_metric_pending_idx ON proxy_metric (check_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS proxy_metric_in_progress_idx ON proxy_metric (worker_id, lease_until) WHERE status = 'in_progress';
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS check_table_callback_next_at_idx;
+
+ALTER TABLE check_table DROP COLUMN callback_delivered_at;
+ALTER TABLE check_table DROP COLUMN callback_next_at;
@@ -0,0 +1,4 @@
+ALTER TABLE check_table ADD COLUMN callback_next_at timestamp;
+ALTER TABLE check_table ADD COLUMN callback_delivered_at timestamp;
+
+CREATE INDEX IF NOT EXISTS check_table_callback_next_at_idx ON check_table (callback_next_at) WHERE callback_next_at IS NOT NULL;
@@ -8,6 +8,7 @@ require (
 	github.com/google/uuid v1.6.0
 	github.com/ilyakaznacheev/cleanenv v1.5.0
 	github.com/jackc/pgx/v5 v5.5.4
+	github.com/oschwald/maxminddb-golang v1.13.1
 	golang.org/x/net v0.47.0
 )
 
@@ -17,11 +17,15 @@ import (
 	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/moroshma/proxy_checker/proxy_checker/internal/config"
 	"github.com/moroshma/proxy_checker/proxy_checker/internal/delivery"
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/events"
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/geo"
 	"github.com/moroshma/proxy_checker/proxy_checker/internal/repository/postgres"
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/secret"
 	"github.com/moroshma/proxy_checker/proxy_checker/internal/service"
 )
 
-func Run(ctx context.Context, cfg *config.Config) error {
+// Run запускает API, чекер очереди или оба в зависимости от mode и работает, пока не отменён ctx
+func Run(ctx context.Context, cfg *config.Config, mode Mode) error {
 	conn, err := pgxpool.New(ctx, fmt.Sprintf("postgres://%s:%s@%s:%s/%s",
 		cfg.Database.User, cfg.Database.Pass, cfg.Database.Host, cfg.Database.Port, cfg.Database.DatabaseName))
 	if err != nil {
@@ -42,22 +46,62 @@ func Run(ctx context.Context, cfg *config.Config) error {
 		return err
 	}
 
-	router := gin.Default()
-	router.Use(gin.Logger())
-	router.Use(gin.Recovery())
+	box, err := secret.NewBox(cfg.Secret.Key)
+	if err != nil {
+		return fmt.Errorf("unable to init credentials encryption: %w", err)
+	}
 
-	registerApi(cfg, conn, router)
+	proxyRepository := postgres.NewProxyRepository(conn)
+	broker := events.NewBroker()
+	publisher := eventPublisher(ctx, cfg, mode, proxyRepository, broker)
+
+	// чекер останавливается после HTTP-сервера, а пул соединений закрывается только после чекера
+	checkerCtx, stopChecker := context.WithCancel(ctx)
+	defer stopChecker()
+	checkerDone := make(chan struct{})
+	if mode.worker() {
+		// базы открываются и при выключенной в конфиге геолокации: её можно включить для отдельной задачи
+		geoProvider, err := geo.New(cfg.Geo)
+		if err != nil {
+			return fmt.Errorf("unable to init geo provider: %w", err)
+		}
+		defer geoProvider.Close()
+
+		cronChecker := service.NewCroneChecker(proxyRepository, cfg.Proxy, box, geoProvider, publisher)
+		go func() {
+			defer close(checkerDone)
+			cronChecker.Run(checkerCtx)
+		}()
+	} else {
+		close(checkerDone)
+	}
 
-	srv := initHttpServer(cfg, router)
+	// узел worker без внешних judge_urls поднимает HTTP-сервер только ради встроенного /judge
+	var srv *http.Server
+	if mode.serve() || len(cfg.Proxy.JudgeURLs) == 0 {
+		router := gin.Default()
+		router.Use(gin.Logger())
+		router.Use(gin.Recovery())
 
-	go func() {
-		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			done <- err
+		if mode.serve() {
+			registerApi(router, proxyRepository, broker, publisher, box)
 		}
-	}()
+		delivery.RegisterJudgeRoutes(router, delivery.NewJudgeHandler())
+
+		srv = initHttpServer(cfg, router)
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				done <- err
+			}
+		}()
+	}
+	slog.Info(fmt.Sprintf("Running in %s mode", mode))
 
 	select {
 	case <-ctx.Done():
+		if srv == nil {
+			break
+		}
 		slog.Info("Shutting down the server...")
 
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -72,6 +116,12 @@ func Run(ctx context.Context, cfg *config.Config) error {
 		}
 	}
 
+	stopChecker()
+	<-checkerDone
+	if mode.worker() {
+		slog.Info("Checker stopped")
+	}
+
 	return nil
 }
 
@@ -86,14 +136,26 @@ func initHttpServer(cfg *config.Config, r *gin.Engine) *http.Server {
 	return srv
 }
 
-func registerApi(cfg *config.Config, conn *pgxpool.Pool, r *gin.Engine) {
-	proxyRepository := postgres.NewProxyRepository(conn)
-	proxyService := service.NewResumeService(proxyRepository)
-	discountHandler := delivery.NewProxyHandler(proxyService)
+func registerApi(r *gin.Engine, proxyRepository *postgres.ProxyRepository, broker *events.Broker,
+	publisher service.EventPublisher, box *secret.Box) {
+	proxyService := service.NewResumeService(proxyRepository, box, publisher)
+	discountHandler := delivery.NewProxyHandler(proxyService, broker)
 	delivery.RegisterServiceRoutes(r, discountHandler)
+}
 
-	cronChecker := service.NewCroneChecker(proxyRepository, cfg.Proxy.Timeout)
-	go cronChecker.Run()
+// eventPublisher выбирает, куда публиковать события задач. При нескольких экземплярах события идут через NOTIFY,
+// а брокер каждого экземпляра с API слушает его. Если API и чекер запущены отдельными процессами,
+// событиям до подписчиков не добраться иначе, поэтому в режимах serve и worker NOTIFY включается всегда.
+func eventPublisher(ctx context.Context, cfg *config.Config, mode Mode, proxyRepository *postgres.ProxyRepository,
+	broker *events.Broker) service.EventPublisher {
+	if !cfg.Events.Notify && mode == ModeAll {
+		return broker
+	}
+
+	if mode.serve() {
+		go proxyRepository.ListenEvents(ctx, broker.Publish)
+	}
+	return proxyRepository
 }
 
 // mustMigrate - функция миграции базы данных
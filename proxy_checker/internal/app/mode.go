@@ -0,0 +1,33 @@
+package app
+
+import "fmt"
+
+// Mode - что запускает процесс: API, чекер очереди или оба.
+// API и чекеры связаны только общей базой, поэтому их можно масштабировать и размещать независимо.
+type Mode string
+
+const (
+	ModeAll    Mode = "all"
+	ModeServe  Mode = "serve"
+	ModeWorker Mode = "worker"
+)
+
+// ParseMode разбирает подкоманду; без подкоманды запускается всё в одном процессе
+func ParseMode(s string) (Mode, error) {
+	switch mode := Mode(s); mode {
+	case "":
+		return ModeAll, nil
+	case ModeAll, ModeServe, ModeWorker:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown mode %q, expected %s, %s or %s", s, ModeServe, ModeWorker, ModeAll)
+	}
+}
+
+func (m Mode) serve() bool {
+	return m == ModeAll || m == ModeServe
+}
+
+func (m Mode) worker() bool {
+	return m == ModeAll || m == ModeWorker
+}
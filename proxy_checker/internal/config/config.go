@@ -13,11 +13,94 @@ type Config struct {
 	Logger   Logger     `yaml:"logger"`
 	Database Database   `yaml:"database"`
 	Proxy    Proxy      `yaml:"proxy"`
+	Secret   Secret     `yaml:"secret"`
+	Geo      Geo        `yaml:"geo"`
+	Events   Events     `yaml:"events"`
+}
+
+// Events - доставка событий задач в потоковые подписки.
+// Notify нужен, когда экземпляров сервиса несколько: события идут через Postgres NOTIFY
+// и доходят до подписчиков любого экземпляра, а не только того, где работал чекер.
+type Events struct {
+	Notify bool `yaml:"notify" env:"EVENTS_NOTIFY" env-default:"false"`
+}
+
+// Geo - источник геолокации прокси: локальные базы .mmdb (GeoLite2 / DB-IP) или ip-api.com
+type Geo struct {
+	Provider string        `yaml:"provider" env:"GEO_PROVIDER" env-default:"mmdb"`
+	CityDB   string        `yaml:"city_db" env:"GEO_CITY_DB"`
+	ASNDB    string        `yaml:"asn_db" env:"GEO_ASN_DB"`
+	Timeout  time.Duration `yaml:"timeout" env-default:"4s"`
+}
+
+// Secret - ключ шифрования учётных данных прокси, хранящихся в базе.
+// Ключ обязателен и не имеет значения по умолчанию, чтобы данные не шифровались общеизвестным ключом.
+type Secret struct {
+	Key string `yaml:"key" env:"SECRET_KEY" env-required:"true"`
 }
 
 type Proxy struct {
-	Timeout time.Duration `yaml:"timeout" env-default:"4s"`
+	Timeout   time.Duration `yaml:"timeout" env-default:"4s"`
+	SpeedTest SpeedTest     `yaml:"speed_test"`
+	// JudgeURLs - внешние judge-сервисы; без них чекер ходит во встроенный /judge своего экземпляра
+	// по адресу http://<PublicIP>:<JudgePort>/judge
+	JudgeURLs []string `yaml:"judge_urls"`
+	// JudgePort - порт встроенного /judge, по умолчанию http_server.port
+	JudgePort string `yaml:"judge_port" env:"JUDGE_PORT"`
+	// PublicIP - внешний IP чекера, по нему распознаются прозрачные прокси.
+	// Если не задан, берётся из ответа PublicIPURL: сервис должен вернуть адрес обычным текстом.
+	PublicIP    string     `yaml:"public_ip" env:"PUBLIC_IP"`
+	PublicIPURL string     `yaml:"public_ip_url" env-default:"https://api.ipify.org"`
+	HTTPSCheck  HTTPSCheck `yaml:"https_check"`
+	// Sniff включает прощупывание порта: полные проверки запускаются только для распознанных протоколов
+	Sniff bool `yaml:"sniff" env-default:"true"`
+	// Samples - сколько раз повторяется замер скорости и задержек, в результат идёт медиана
+	Samples int `yaml:"samples" env-default:"1"`
+	// Geolocation - геолокация по умолчанию для задач, без поля geolocation в настройках задачи
+	Geolocation bool    `yaml:"geolocation" env-default:"true"`
+	Webhook     Webhook `yaml:"webhook"`
+	Queue       Queue   `yaml:"queue"`
+}
+
+// Queue - очередь проверок в базе, общая для всех экземпляров.
+// Экземпляр забирает до BatchSize адресов со всеми их проверками в аренду на Lease и продлевает её каждые Heartbeat,
+// пока проверяет; аренду упавшего экземпляра по истечении Lease забирают другие.
+// Новые задачи приходят через LISTEN/NOTIFY, а PollInterval - запасной опрос очереди.
+// Workers горутин проверяют адреса, в памяти одновременно не больше Buffer забранных адресов.
+type Queue struct {
+	Workers      int           `yaml:"workers" env:"QUEUE_WORKERS" env-default:"10"`
+	Buffer       int           `yaml:"buffer" env-default:"200"`
+	BatchSize    int           `yaml:"batch_size" env-default:"100"`
+	Lease        time.Duration `yaml:"lease" env-default:"2m"`
+	Heartbeat    time.Duration `yaml:"heartbeat" env-default:"30s"`
+	PollInterval time.Duration `yaml:"poll_interval" env-default:"30s"`
+	// ShutdownGrace - сколько при остановке ждать идущие проверки, прежде чем прервать их
+	ShutdownGrace time.Duration `yaml:"shutdown_grace" env:"QUEUE_SHUTDOWN_GRACE" env-default:"30s"`
 }
+
+// Webhook - доставка сводки завершённой задачи на callback_url.
+// Пауза между попытками начинается с Backoff и удваивается после каждой неудачи.
+type Webhook struct {
+	Timeout     time.Duration `yaml:"timeout" env-default:"10s"`
+	MaxAttempts int           `yaml:"max_attempts" env-default:"5"`
+	Backoff     time.Duration `yaml:"backoff" env-default:"2s"`
+}
+
+// HTTPSCheck описывает проверку туннеля HTTP CONNECT: TLS-запрос через туннель
+// и список портов, CONNECT на которые пробуется к хосту port_host
+type HTTPSCheck struct {
+	URL      string `yaml:"url" env-default:"https://httpbin.org/get"`
+	PortHost string `yaml:"port_host" env-default:"portquiz.net"`
+	Ports    []int  `yaml:"ports" env-default:"443,80,8080,22,25"`
+}
+
+// SpeedTest описывает файл, который скачивается через прокси для замера скорости
+type SpeedTest struct {
+	URL         string        `yaml:"url" env-default:"http://speedtest.tele2.net/1MB.zip"`
+	Size        int64         `yaml:"size" env-default:"1048576"`
+	MaxDuration time.Duration `yaml:"max_duration" env-default:"10s"`
+}
+
 type HTTPServer struct {
 	Host        string        `yaml:"host" env-default:"localhost"`
 	Port        string        `yaml:"port" env-default:"8080"`
@@ -53,5 +136,9 @@ func MustLoad() *Config {
 		log.Fatalf("cannot read config: %s", err)
 	}
 
+	if cfg.Proxy.JudgePort == "" {
+		cfg.Proxy.JudgePort = cfg.HTTP.Port
+	}
+
 	return &cfg
 }
@@ -0,0 +1,36 @@
+package delivery
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JudgeHandler struct{}
+
+func NewJudgeHandler() *JudgeHandler {
+	return &JudgeHandler{}
+}
+
+// Echo возвращает адрес, с которого пришёл запрос, и все его заголовки в формате httpbin.org/get.
+// Адрес берётся из соединения, а не из X-Forwarded-For, иначе прозрачный прокси не отличить от элитного.
+func (handler *JudgeHandler) Echo(con *gin.Context) {
+	origin, _, err := net.SplitHostPort(con.Request.RemoteAddr)
+	if err != nil {
+		origin = con.Request.RemoteAddr
+	}
+
+	headers := make(map[string]string, len(con.Request.Header)+1)
+	for name, values := range con.Request.Header {
+		headers[name] = strings.Join(values, ", ")
+	}
+	headers["Host"] = con.Request.Host
+
+	con.JSON(http.StatusOK, gin.H{
+		"origin":      origin,
+		"remote_addr": con.Request.RemoteAddr,
+		"headers":     headers,
+	})
+}
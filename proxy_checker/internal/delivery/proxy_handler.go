@@ -2,6 +2,8 @@ package delivery
 
 import (
 	"context"
+	"errors"
+	"io"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -11,16 +13,21 @@ import (
 type ProxyUseCase interface {
 	CreateTaskProxy(ctx context.Context, resumeObject models.ProxyCheckApiModelRes) (models.ProxyCheckServiceResponse, error)
 	GetStatusProxy(ctx context.Context, resumeObject models.ProxyResultServiceReq) ([]models.ProxyResultServiceResponse, error)
-	GetHistory(ctx context.Context) ([]models.HistoryItem, error)
+	GetHistory(ctx context.Context, filter models.HistoryFilter) (models.HistoryPage, error)
+	GetSummary(ctx context.Context, checkID string) (models.TaskSummary, error)
+	CancelTask(ctx context.Context, checkID string) (models.CancelTaskResponse, error)
+	Recheck(ctx context.Context, checkID string, req models.RecheckReq) (models.ProxyCheckServiceResponse, error)
 }
 
 type ProxyHandler struct {
 	proxyService ProxyUseCase
+	events       EventSubscriber
 }
 
-func NewProxyHandler(resumeUseCase ProxyUseCase) *ProxyHandler {
+func NewProxyHandler(resumeUseCase ProxyUseCase, events EventSubscriber) *ProxyHandler {
 	return &ProxyHandler{
 		proxyService: resumeUseCase,
+		events:       events,
 	}
 }
 
@@ -33,7 +40,7 @@ func (handler *ProxyHandler) Create(con *gin.Context) {
 
 	id, err := handler.proxyService.CreateTaskProxy(context.Background(), statistic)
 	if err != nil {
-		con.JSON(http.StatusConflict, err)
+		con.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 		return
 	}
 	con.JSON(http.StatusCreated, id)
@@ -46,7 +53,20 @@ func (handler *ProxyHandler) GetStatus(con *gin.Context) {
 		return
 	}
 
-	result, err := handler.proxyService.GetStatusProxy(context.Background(), models.ProxyResultServiceReq{TaskUUID: id})
+	var filter models.ProxyResultFilter
+	if err := con.ShouldBindQuery(&filter); err != nil {
+		con.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := handler.proxyService.GetStatusProxy(context.Background(), models.ProxyResultServiceReq{
+		TaskUUID:          id,
+		ProxyResultFilter: filter,
+	})
+	if errors.Is(err, models.ErrTaskNotFound) {
+		con.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		con.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -56,7 +76,43 @@ func (handler *ProxyHandler) GetStatus(con *gin.Context) {
 }
 
 func (handler *ProxyHandler) GetHistory(con *gin.Context) {
-	result, err := handler.proxyService.GetHistory(context.Background())
+	var req models.HistoryReq
+	if err := con.ShouldBindQuery(&req); err != nil {
+		con.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter := models.HistoryFilter{From: req.From, To: req.To, Limit: req.Limit}
+	if req.Cursor != "" {
+		cursor, err := models.ParseHistoryCursor(req.Cursor)
+		if err != nil {
+			con.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		filter.After = &cursor
+	}
+
+	result, err := handler.proxyService.GetHistory(context.Background(), filter)
+	if err != nil {
+		con.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	con.JSON(http.StatusOK, result)
+}
+
+func (handler *ProxyHandler) GetSummary(con *gin.Context) {
+	id := con.Param("id")
+	if id == "" {
+		con.JSON(http.StatusBadRequest, gin.H{"error": "missing id parameter"})
+		return
+	}
+
+	result, err := handler.proxyService.GetSummary(context.Background(), id)
+	if errors.Is(err, models.ErrTaskNotFound) {
+		con.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		con.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -64,3 +120,53 @@ func (handler *ProxyHandler) GetHistory(con *gin.Context) {
 
 	con.JSON(http.StatusOK, result)
 }
+
+func (handler *ProxyHandler) Cancel(con *gin.Context) {
+	id := con.Param("id")
+	if id == "" {
+		con.JSON(http.StatusBadRequest, gin.H{"error": "missing id parameter"})
+		return
+	}
+
+	result, err := handler.proxyService.CancelTask(context.Background(), id)
+	switch {
+	case errors.Is(err, models.ErrTaskNotFound):
+		con.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, models.ErrTaskFinished):
+		con.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		con.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	con.JSON(http.StatusOK, result)
+}
+
+func (handler *ProxyHandler) Recheck(con *gin.Context) {
+	id := con.Param("id")
+	if id == "" {
+		con.JSON(http.StatusBadRequest, gin.H{"error": "missing id parameter"})
+		return
+	}
+
+	// тело необязательно: без него перепроверяются все адреса с прежними настройками
+	var req models.RecheckReq
+	if err := con.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		con.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := handler.proxyService.Recheck(context.Background(), id, req)
+	switch {
+	case errors.Is(err, models.ErrTaskNotFound):
+		con.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		con.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	con.JSON(http.StatusCreated, result)
+}
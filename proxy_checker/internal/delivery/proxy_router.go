@@ -7,4 +7,13 @@ func RegisterServiceRoutes(server *gin.Engine, proxyHandler *ProxyHandler) {
 	proxyRoute.POST("", proxyHandler.Create)
 	proxyRoute.GET("/history", proxyHandler.GetHistory)
 	proxyRoute.GET("/:id", proxyHandler.GetStatus)
+	proxyRoute.GET("/:id/summary", proxyHandler.GetSummary)
+	proxyRoute.GET("/:id/stream", proxyHandler.Stream)
+	proxyRoute.DELETE("/:id", proxyHandler.Cancel)
+	proxyRoute.POST("/:id/cancel", proxyHandler.Cancel)
+	proxyRoute.POST("/:id/recheck", proxyHandler.Recheck)
+}
+
+func RegisterJudgeRoutes(server *gin.Engine, judgeHandler *JudgeHandler) {
+	server.GET("/judge", judgeHandler.Echo)
 }
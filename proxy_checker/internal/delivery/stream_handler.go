@@ -0,0 +1,146 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/models"
+)
+
+// streamKeepAlive - период комментариев-пингов, чтобы прокси и балансировщики не рвали тихий поток
+const streamKeepAlive = 15 * time.Second
+
+type EventSubscriber interface {
+	Subscribe(checkID string) (<-chan models.TaskEvent, func())
+}
+
+// Stream отдаёт результаты задачи по мере проверки как Server-Sent Events:
+// событие result на каждую сохранённую проверку и итоговое done со сводкой задачи.
+// Уже сохранённые к моменту подключения результаты не повторяются, их отдаёт GET /proxy/{id}.
+func (handler *ProxyHandler) Stream(con *gin.Context) {
+	id := con.Param("id")
+	if id == "" {
+		con.JSON(http.StatusBadRequest, gin.H{"error": "missing id parameter"})
+		return
+	}
+	// некорректный id отсекается до подписки, чтобы не регистрировать подписчика на заведомо несуществующую задачу
+	if _, err := models.ParseCheckID(id); err != nil {
+		con.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// подписываемся до чтения сводки, чтобы не пропустить завершение между ними
+	events, unsubscribe := handler.events.Subscribe(id)
+	defer unsubscribe()
+
+	summary, err := handler.proxyService.GetSummary(context.Background(), id)
+	if errors.Is(err, models.ErrTaskNotFound) {
+		con.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		con.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	con.Header("Content-Type", "text/event-stream")
+	con.Header("Cache-Control", "no-cache")
+	con.Header("Connection", "keep-alive")
+	con.Header("X-Accel-Buffering", "no")
+	con.Status(http.StatusOK)
+	// без сброса клиент не получит ни статус, ни заголовки до первого события или пинга
+	con.Writer.Flush()
+
+	// поток живёт дольше HTTPServer.Timeout, поэтому дедлайн записи продлевается перед каждой отправкой
+	rc := http.NewResponseController(con.Writer)
+	extend := func() {
+		if err := rc.SetWriteDeadline(time.Now().Add(2 * streamKeepAlive)); err != nil {
+			slog.Debug(fmt.Sprintf("unable to extend stream write deadline: %v", err))
+		}
+	}
+
+	if summary.State == models.TaskDone || summary.State == models.TaskCancelled {
+		extend()
+		con.SSEvent(models.EventDone, summary)
+		con.Writer.Flush()
+		return
+	}
+
+	ticker := time.NewTicker(streamKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-con.Request.Context().Done():
+			return
+
+		case <-ticker.C:
+			extend()
+			fmt.Fprint(con.Writer, ": keep-alive\n\n")
+
+		case event, ok := <-events:
+			extend()
+			if !ok {
+				handler.abortStream(con, id)
+				return
+			}
+			if event.Type == models.EventResult {
+				con.SSEvent(models.EventResult, event.Result)
+				break
+			}
+
+			handler.finishStream(con, events, id)
+			return
+		}
+		con.Writer.Flush()
+	}
+}
+
+// finishStream дописывает результаты, успевшие прийти вместе с завершением, и закрывает поток сводкой
+func (handler *ProxyHandler) finishStream(con *gin.Context, events <-chan models.TaskEvent, id string) {
+	for drained := false; !drained; {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				drained = true
+				break
+			}
+			if event.Type == models.EventResult {
+				con.SSEvent(models.EventResult, event.Result)
+			}
+		default:
+			drained = true
+		}
+	}
+
+	summary, err := handler.proxyService.GetSummary(context.Background(), id)
+	if err != nil {
+		slog.Error(fmt.Sprintf("stream summary error: %v", err))
+		con.SSEvent(models.EventDone, gin.H{"check_id": id})
+	} else {
+		con.SSEvent(models.EventDone, summary)
+	}
+	con.Writer.Flush()
+}
+
+// abortStream закрывает поток, от которого брокер отключился из-за медленного чтения.
+// Если задача уже завершилась, поток закрывается сводкой, иначе обрывается без done:
+// EventSource переподключится сам, а пропущенные результаты есть в GET /proxy/{id}.
+func (handler *ProxyHandler) abortStream(con *gin.Context, id string) {
+	slog.Warn(fmt.Sprintf("stream of check %s is too slow, closing it", id))
+
+	summary, err := handler.proxyService.GetSummary(context.Background(), id)
+	if err != nil {
+		slog.Error(fmt.Sprintf("stream summary error: %v", err))
+		return
+	}
+	if summary.State == models.TaskDone || summary.State == models.TaskCancelled {
+		con.SSEvent(models.EventDone, summary)
+		con.Writer.Flush()
+	}
+}
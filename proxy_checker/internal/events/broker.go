@@ -0,0 +1,70 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/models"
+)
+
+// subscriberBuffer - сколько событий копится у медленного подписчика, прежде чем брокер от него отключится
+const subscriberBuffer = 256
+
+// Broker раздаёт события задач подписчикам внутри процесса
+type Broker struct {
+	mu   sync.RWMutex
+	subs map[string]map[chan models.TaskEvent]struct{}
+}
+
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[string]map[chan models.TaskEvent]struct{})}
+}
+
+// Subscribe подписывает на события задачи checkID. Возвращённую функцию нужно вызвать, когда события больше не нужны.
+func (b *Broker) Subscribe(checkID string) (<-chan models.TaskEvent, func()) {
+	ch := make(chan models.TaskEvent, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.subs[checkID] == nil {
+		b.subs[checkID] = make(map[chan models.TaskEvent]struct{})
+	}
+	b.subs[checkID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			b.remove(checkID, ch)
+			b.mu.Unlock()
+		})
+	}
+}
+
+// Publish не блокируется. Если подписчик не успевает читать, брокер закрывает его канал, а не теряет событие молча:
+// закрытие подписчик увидит всегда, в том числе вместо потерянного done.
+func (b *Broker) Publish(_ context.Context, event models.TaskEvent) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs[event.CheckID] {
+		select {
+		case ch <- event:
+		default:
+			slog.Warn(fmt.Sprintf("subscriber of check %s is too slow, unsubscribed on %s event", event.CheckID, event.Type))
+			b.remove(event.CheckID, ch)
+			close(ch)
+		}
+	}
+	return nil
+}
+
+// remove вызывается под b.mu
+func (b *Broker) remove(checkID string, ch chan models.TaskEvent) {
+	delete(b.subs[checkID], ch)
+	if len(b.subs[checkID]) == 0 {
+		delete(b.subs, checkID)
+	}
+}
@@ -0,0 +1,56 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/config"
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/models"
+)
+
+const (
+	ProviderMMDB  = "mmdb"
+	ProviderIPAPI = "ip-api"
+)
+
+// Provider определяет местоположение и сеть по IP-адресу
+type Provider interface {
+	Lookup(ctx context.Context, ip string) (models.Location, error)
+	Close() error
+}
+
+// New создаёт провайдера геолокации, выбранного в конфиге.
+// Базы .mmdb не входят в репозиторий, поэтому без файла базы возвращается Noop с предупреждением в лог,
+// а не ошибка: чекер работает, просто не заполняя местоположение.
+func New(cfg config.Geo) (Provider, error) {
+	switch cfg.Provider {
+	case ProviderMMDB:
+		db, err := NewMMDB(cfg.CityDB, cfg.ASNDB)
+		if errors.Is(err, fs.ErrNotExist) {
+			slog.Warn(fmt.Sprintf("geolocation disabled: %v", err))
+			return Noop{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	case ProviderIPAPI:
+		return NewIPAPI(cfg.Timeout), nil
+	default:
+		return nil, fmt.Errorf("unknown geo provider: %s", cfg.Provider)
+	}
+}
+
+// Noop - провайдер выключенной геолокации, любой поиск возвращает models.ErrGeoDisabled
+type Noop struct{}
+
+func (Noop) Lookup(context.Context, string) (models.Location, error) {
+	return models.Location{}, models.ErrGeoDisabled
+}
+
+func (Noop) Close() error {
+	return nil
+}
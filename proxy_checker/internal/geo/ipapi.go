@@ -0,0 +1,48 @@
+package geo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/models"
+)
+
+// IPAPI ищет адреса через ip-api.com. Сервис ограничен 45 запросами в минуту
+// и видит все проверяемые адреса, поэтому по умолчанию используется MMDB.
+type IPAPI struct {
+	client *http.Client
+}
+
+func NewIPAPI(timeout time.Duration) *IPAPI {
+	return &IPAPI{client: &http.Client{Timeout: timeout}}
+}
+
+func (a *IPAPI) Lookup(ctx context.Context, ip string) (models.Location, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://ip-api.com/json/"+ip, nil)
+	if err != nil {
+		return models.Location{}, err
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return models.Location{}, err
+	}
+	defer resp.Body.Close()
+
+	var location models.Location
+	if err := json.NewDecoder(resp.Body).Decode(&location); err != nil {
+		return models.Location{}, err
+	}
+	if location.Status != "success" {
+		return models.Location{}, fmt.Errorf("ip-api lookup for %s failed: %s", ip, location.Status)
+	}
+
+	return location, nil
+}
+
+func (a *IPAPI) Close() error {
+	return nil
+}
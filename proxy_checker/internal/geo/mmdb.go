@@ -0,0 +1,130 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/models"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// cityRecord - поля базы формата GeoLite2 City / DB-IP City Lite, которые нужны чекеру
+type cityRecord struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	Location struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+		TimeZone  string  `maxminddb:"time_zone"`
+	} `maxminddb:"location"`
+	Postal struct {
+		Code string `maxminddb:"code"`
+	} `maxminddb:"postal"`
+}
+
+// asnRecord - поля базы формата GeoLite2 ASN / DB-IP ASN Lite
+type asnRecord struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// MMDB ищет адреса в локальных файлах .mmdb, без обращения к внешним сервисам.
+// База ASN необязательна: без неё, в том числе если файла нет, в ответе не будет провайдера и автономной системы.
+type MMDB struct {
+	city *maxminddb.Reader
+	asn  *maxminddb.Reader
+}
+
+func NewMMDB(cityPath, asnPath string) (*MMDB, error) {
+	if cityPath == "" {
+		return nil, fmt.Errorf("geo city database path is not set: %w", fs.ErrNotExist)
+	}
+
+	city, err := maxminddb.Open(cityPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open geo city database: %w", err)
+	}
+
+	db := &MMDB{city: city}
+	if asnPath != "" {
+		db.asn, err = maxminddb.Open(asnPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			slog.Warn(fmt.Sprintf("geo asn database not found, asn lookups disabled: %v", err))
+			return db, nil
+		}
+		if err != nil {
+			city.Close()
+			return nil, fmt.Errorf("unable to open geo asn database: %w", err)
+		}
+	}
+
+	return db, nil
+}
+
+func (m *MMDB) Lookup(_ context.Context, ip string) (models.Location, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return models.Location{}, fmt.Errorf("incorrect ip: %s", ip)
+	}
+
+	var city cityRecord
+	if err := m.city.Lookup(addr, &city); err != nil {
+		return models.Location{}, err
+	}
+
+	location := models.Location{
+		Query:       addr.String(),
+		Status:      "success",
+		Country:     city.Country.Names["en"],
+		CountryCode: city.Country.ISOCode,
+		City:        city.City.Names["en"],
+		Zip:         city.Postal.Code,
+		Lat:         city.Location.Latitude,
+		Lon:         city.Location.Longitude,
+		Timezone:    city.Location.TimeZone,
+	}
+	if len(city.Subdivisions) > 0 {
+		location.Region = city.Subdivisions[0].ISOCode
+		location.RegionName = city.Subdivisions[0].Names["en"]
+	}
+
+	if m.asn != nil {
+		var asn asnRecord
+		if err := m.asn.Lookup(addr, &asn); err != nil {
+			return models.Location{}, err
+		}
+		if asn.Number != 0 {
+			// формат ip-api: "AS15169 Google LLC"
+			location.As = fmt.Sprintf("AS%d %s", asn.Number, asn.Organization)
+			location.Isp = asn.Organization
+			location.Org = asn.Organization
+		}
+	}
+
+	if location.CountryCode == "" && location.As == "" {
+		return models.Location{}, fmt.Errorf("ip %s is not found in geo database", ip)
+	}
+
+	return location, nil
+}
+
+func (m *MMDB) Close() error {
+	err := m.city.Close()
+	if m.asn != nil {
+		err = errors.Join(err, m.asn.Close())
+	}
+	return err
+}
@@ -0,0 +1,133 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/config"
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/models"
+)
+
+// Базы в testdata собраны генератором testdata/gen из документационных диапазонов адресов
+var (
+	testCityDB = filepath.Join("testdata", "city.mmdb")
+	testASNDB  = filepath.Join("testdata", "asn.mmdb")
+)
+
+func TestMMDBLookup(t *testing.T) {
+	db, err := NewMMDB(testCityDB, testASNDB)
+	if err != nil {
+		t.Fatalf("NewMMDB: %v", err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		name    string
+		ip      string
+		want    models.Location
+		wantErr bool
+	}{
+		{
+			name: "city and asn",
+			ip:   "192.0.2.10",
+			want: models.Location{
+				Query:       "192.0.2.10",
+				Status:      "success",
+				Country:     "Poland",
+				CountryCode: "PL",
+				Region:      "14",
+				RegionName:  "Mazovia",
+				City:        "Warsaw",
+				Zip:         "00-001",
+				Lat:         52.2297,
+				Lon:         21.0122,
+				Timezone:    "Europe/Warsaw",
+				Isp:         "Example Net",
+				Org:         "Example Net",
+				As:          "AS64496 Example Net",
+			},
+		},
+		{
+			name: "country only ipv6",
+			ip:   "2001:db8::1",
+			want: models.Location{Query: "2001:db8::1", Status: "success", Country: "Germany", CountryCode: "DE"},
+		},
+		{
+			name: "asn only",
+			ip:   "198.51.100.7",
+			want: models.Location{
+				Query:  "198.51.100.7",
+				Status: "success",
+				Isp:    "Only ASN Org",
+				Org:    "Only ASN Org",
+				As:     "AS64511 Only ASN Org",
+			},
+		},
+		{name: "not found", ip: "203.0.113.1", wantErr: true},
+		{name: "invalid ip", ip: "not-an-ip", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.Lookup(context.Background(), tt.ip)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Lookup(%s) = %+v, want error", tt.ip, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Lookup(%s): %v", tt.ip, err)
+			}
+			if got != tt.want {
+				t.Errorf("Lookup(%s) =\n%+v\nwant\n%+v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMMDBWithoutASN(t *testing.T) {
+	db, err := NewMMDB(testCityDB, filepath.Join(t.TempDir(), "missing.mmdb"))
+	if err != nil {
+		t.Fatalf("NewMMDB with missing asn database: %v", err)
+	}
+	defer db.Close()
+
+	got, err := db.Lookup(context.Background(), "192.0.2.10")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if got.City != "Warsaw" || got.As != "" {
+		t.Errorf("Lookup without asn database = %+v", got)
+	}
+}
+
+func TestNewFallsBackToNoop(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Geo
+	}{
+		{name: "missing file", cfg: config.Geo{Provider: ProviderMMDB, CityDB: filepath.Join(t.TempDir(), "missing.mmdb")}},
+		{name: "empty path", cfg: config.Geo{Provider: ProviderMMDB}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, err := New(tt.cfg)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			if _, err := provider.Lookup(context.Background(), "192.0.2.10"); !errors.Is(err, models.ErrGeoDisabled) {
+				t.Errorf("Lookup error = %v, want %v", err, models.ErrGeoDisabled)
+			}
+		})
+	}
+}
+
+func TestNewUnknownProvider(t *testing.T) {
+	if _, err := New(config.Geo{Provider: "whois"}); err == nil {
+		t.Error("New with unknown provider returned no error")
+	}
+}
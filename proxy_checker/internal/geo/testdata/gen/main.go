@@ -0,0 +1,88 @@
+// Генерирует крошечные базы .mmdb для тестов пакета geo из документационных диапазонов адресов
+// (RFC 5737, RFC 3849), которых нет в настоящих базах.
+//
+//	cd internal/geo/testdata/gen && go run . ..
+//
+// mmdbwriter нужен только здесь, поэтому у генератора свой go.mod.
+package main
+
+import (
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+func main() {
+	dir := "."
+	if len(os.Args) > 1 {
+		dir = os.Args[1]
+	}
+
+	names := func(en string) mmdbtype.Map {
+		return mmdbtype.Map{"en": mmdbtype.String(en)}
+	}
+
+	write(filepath.Join(dir, "city.mmdb"), "GeoLite2-City", map[string]mmdbtype.Map{
+		"192.0.2.0/24": {
+			"city":    mmdbtype.Map{"names": names("Warsaw")},
+			"country": mmdbtype.Map{"iso_code": mmdbtype.String("PL"), "names": names("Poland")},
+			"subdivisions": mmdbtype.Slice{
+				mmdbtype.Map{"iso_code": mmdbtype.String("14"), "names": names("Mazovia")},
+			},
+			"location": mmdbtype.Map{
+				"latitude":  mmdbtype.Float64(52.2297),
+				"longitude": mmdbtype.Float64(21.0122),
+				"time_zone": mmdbtype.String("Europe/Warsaw"),
+			},
+			"postal": mmdbtype.Map{"code": mmdbtype.String("00-001")},
+		},
+		"2001:db8::/32": {
+			"country": mmdbtype.Map{"iso_code": mmdbtype.String("DE"), "names": names("Germany")},
+		},
+	})
+
+	write(filepath.Join(dir, "asn.mmdb"), "GeoLite2-ASN", map[string]mmdbtype.Map{
+		"192.0.2.0/24": {
+			"autonomous_system_number":       mmdbtype.Uint32(64496),
+			"autonomous_system_organization": mmdbtype.String("Example Net"),
+		},
+		"198.51.100.0/24": {
+			"autonomous_system_number":       mmdbtype.Uint32(64511),
+			"autonomous_system_organization": mmdbtype.String("Only ASN Org"),
+		},
+	})
+}
+
+func write(path, dbType string, records map[string]mmdbtype.Map) {
+	tree, err := mmdbwriter.New(mmdbwriter.Options{
+		DatabaseType:            dbType,
+		IncludeReservedNetworks: true,
+		RecordSize:              24,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for cidr, record := range records {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := tree.Insert(network, record); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := tree.WriteTo(f); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,16 @@
+package models
+
+// Типы событий задачи проверки
+const (
+	// EventResult - сохранён результат одной проверки
+	EventResult = "result"
+	// EventDone - в задаче не осталось незавершённых проверок
+	EventDone = "done"
+)
+
+// TaskEvent - событие задачи проверки, которое чекер публикует для потоковых подписчиков
+type TaskEvent struct {
+	Type    string                      `json:"type"`
+	CheckID string                      `json:"check_id"`
+	Result  *ProxyResultServiceResponse `json:"result,omitempty"`
+}
@@ -1,5 +1,10 @@
 package models
 
+import "errors"
+
+// ErrGeoDisabled - геолокация выключена или её базы не найдены, местоположение не определяется
+var ErrGeoDisabled = errors.New("geolocation is disabled")
+
 type Location struct {
 	Query       string  `json:"query"`
 	Status      string  `json:"status"`
@@ -16,3 +21,28 @@ type Location struct {
 	Org         string  `json:"org"`
 	As          string  `json:"as"`
 }
+
+// Виды местоположения прокси в proxy_location
+const (
+	LocationEntry = "entry"
+	LocationExit  = "exit"
+)
+
+// GeoLocation - местоположение и сеть адреса прокси, одна строка proxy_location.
+// json-теги совпадают с именами колонок, строка читается из базы через to_jsonb.
+type GeoLocation struct {
+	IP          string  `json:"ip"`
+	Country     string  `json:"country"`
+	CountryCode string  `json:"country_code"`
+	Region      string  `json:"region"`
+	RegionName  string  `json:"region_name"`
+	City        string  `json:"city"`
+	Zip         string  `json:"zip"`
+	Lat         float64 `json:"lat"`
+	Lon         float64 `json:"lon"`
+	Timezone    string  `json:"timezone"`
+	ISP         string  `json:"isp"`
+	Org         string  `json:"org"`
+	ASN         int     `json:"asn"`
+	ASName      string  `json:"as_name"`
+}
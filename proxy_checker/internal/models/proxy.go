@@ -9,21 +9,73 @@ import (
 type Proxy struct {
 	ProxyID       uuid.UUID
 	CheckID       uuid.UUID `db:"id"`
+	Host          string    `json:"host"`
 	IP            string    `json:"ip"`
+	ResolvedIPs   []string  `json:"resolved_ips"`
 	Port          string    `json:"port"`
-	City          string    `json:"city"`
 	RealIP        string    `json:"real_ip"`
+	EntryLocation *GeoLocation
+	ExitLocation  *GeoLocation
+	GeoMismatch   bool `json:"geo_mismatch"`
 	ProxyMetricID uuid.UUID
 	Type          string
+	Credentials   []byte
+	Username      string
+	Password      string
+	Options       CheckOptions
 }
 
+// Типы проверок прокси, для каждого создаётся своя строка proxy_metric
+const (
+	TypeSOCKS5  = "SOCKS5"
+	TypeSOCKS4  = "SOCKS4"
+	TypeSOCKS4A = "SOCKS4A"
+	TypeHTTP    = "HTTP"
+	TypeHTTPS   = "HTTPS"
+)
+
+var ProxyTypes = []string{TypeSOCKS5, TypeSOCKS4, TypeSOCKS4A, TypeHTTP, TypeHTTPS}
+
+// Уровни анонимности прокси
+const (
+	AnonymityTransparent = "transparent"
+	AnonymityAnonymous   = "anonymous"
+	AnonymityElite       = "elite"
+)
+
+// Причины, по которым проверка прокси не прошла
+const (
+	FailReasonFailed        = "failed"
+	FailReasonAuthRequired  = "auth_required"
+	FailReasonAuthFailed    = "auth_failed"
+	FailReasonResolveFailed = "resolve_failed"
+	FailReasonNotDetected   = "not_detected"
+)
+
 type ProxyMetric struct {
 	ProxyMetricID uuid.UUID
+	// WorkerID - экземпляр чекера, который держит проверку в аренде
+	WorkerID      string
 	CheckID       uuid.UUID `db:"id"`
 	Type          string    `json:"type"`
 	IsWork        bool      `json:"is_work"`
 	Speed         int       `json:"speed"`
 	Status        string    `json:"status"`
+	FailReason    string    `json:"fail_reason"`
+	Anonymity     string    `json:"anonymity"`
+	LeakedHeaders []string  `json:"leaked_headers"`
+	// ConnectAllowed и AllowedPorts заполняются только для проверки HTTPS
+	ConnectAllowed *bool `json:"connect_allowed"`
+	AllowedPorts   []int `json:"allowed_ports"`
+	Latency
+}
+
+// Latency - разбивка задержек одной проверки в миллисекундах
+type Latency struct {
+	ConnectMs   int `json:"connect_ms"`
+	HandshakeMs int `json:"handshake_ms"`
+	TLSMs       int `json:"tls_ms"`
+	TTFBMs      int `json:"ttfb_ms"`
 }
 
 type CheckTable struct {
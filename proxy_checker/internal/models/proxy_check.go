@@ -1,13 +1,84 @@
 package models
 
+import "github.com/google/uuid"
+
 type ProxyCheckApiModelRes struct {
-	ProxyAddress []string `json:"proxy_address"`
+	ProxyAddress []string      `json:"proxy_address"`
+	Options      *CheckOptions `json:"options"`
+	// CallbackURL получает POST со сводкой, когда задача завершена; CallbackSecret - ключ HMAC-подписи
+	CallbackURL    string `json:"callback_url"`
+	CallbackSecret string `json:"callback_secret"`
+}
+
+// CheckTask - параметры задачи проверки, сохраняемые в check_table
+type CheckTask struct {
+	Options  CheckOptions
+	Callback Callback
+	// ParentCheckID - задача, из которой создана повторная проверка
+	ParentCheckID *uuid.UUID
+}
+
+// RecheckReq - тело POST /proxy/{id}/recheck, все поля необязательны.
+// Без Options повторная проверка идёт с настройками исходной задачи.
+type RecheckReq struct {
+	Filter         string        `json:"filter" binding:"omitempty,oneof=all failed working"`
+	Options        *CheckOptions `json:"options"`
+	CallbackURL    string        `json:"callback_url"`
+	CallbackSecret string        `json:"callback_secret"`
+}
+
+// Фильтры адресов для повторной проверки
+const (
+	RecheckAll     = "all"
+	RecheckFailed  = "failed"
+	RecheckWorking = "working"
+)
+
+// Callback - вебхук задачи. Secret хранится зашифрованным, как и учётные данные прокси.
+type Callback struct {
+	URL    string
+	Secret []byte
+}
+
+// WebhookAttempt - одна попытка доставки вебхука, сохраняется в webhook_attempt
+type WebhookAttempt struct {
+	CheckID    uuid.UUID
+	Attempt    int
+	URL        string
+	StatusCode int
+	Error      string
+	DurationMs int
+}
+
+// WebhookDelivery - доставка вебхука, забранная из очереди в check_table; Attempt - номер очередной попытки
+type WebhookDelivery struct {
+	CheckID uuid.UUID
+	Attempt int
+}
+
+// CheckOptions - настройки проверки, заданные при создании задачи и сохраняемые в check_table.
+// Незаданные поля берутся из конфига.
+type CheckOptions struct {
+	Protocols   []string `json:"protocols,omitempty"`
+	TimeoutMs   int      `json:"timeout_ms,omitempty"`
+	Samples     int      `json:"samples,omitempty"`
+	TargetURLs  []string `json:"target_urls,omitempty"`
+	Geolocation *bool    `json:"geolocation,omitempty"`
 }
 type ProxyCheckServiceReq struct {
-	IP   string `json:"ip"`
-	Port int    `json:"port"`
+	Host string `json:"host"`
+	// IP заполняется, только если хост задан IP-адресом
+	IP       string `json:"ip"`
+	Port     int    `json:"port"`
+	Username string `json:"-"`
+	Password string `json:"-"`
+	// Credentials - зашифрованная пара "логин:пароль", в базу попадает только она
+	Credentials []byte   `json:"-"`
+	Types       []string `json:"types"`
 }
 
 type ProxyCheckServiceResponse struct {
-	CheckID string `json:"check_id"`
+	CheckID       string `json:"check_id"`
+	ParentCheckID string `json:"parent_check_id,omitempty"`
+	ProxyCount    int    `json:"proxy_count,omitempty"`
 }
@@ -1,9 +1,32 @@
 package models
 
-import "time"
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type ProxyResultServiceReq struct {
 	TaskUUID string `json:"task_uuid"`
+	ProxyResultFilter
+}
+
+// ProxyResultFilter - фильтры, сортировка и страница результатов из query-параметров GET /proxy/{id}.
+// Нулевые значения означают «без фильтра».
+type ProxyResultFilter struct {
+	IsWork     *bool  `form:"is_work"`
+	Type       string `form:"type" binding:"omitempty,oneof=SOCKS5 SOCKS4 SOCKS4A HTTP HTTPS"`
+	Status     string `form:"status" binding:"omitempty,oneof=pending in_progress checked cancelled"`
+	Country    string `form:"country" binding:"omitempty,len=2"`
+	ASN        int    `form:"asn" binding:"omitempty,min=1"`
+	MinSpeed   int    `form:"min_speed" binding:"omitempty,min=0"`
+	MaxLatency int    `form:"max_latency" binding:"omitempty,min=0"`
+	Sort       string `form:"sort" binding:"omitempty,oneof=speed latency country type host"`
+	Limit      int    `form:"limit" binding:"omitempty,min=0,max=500"`
+	Offset     int    `form:"offset" binding:"omitempty,min=0"`
 }
 
 type ProxyResultServiceResponse struct {
@@ -12,14 +35,91 @@ type ProxyResultServiceResponse struct {
 	IsWork  bool   `json:"is_work"`
 	Speed   int    `json:"speed"`
 	Status  string `json:"status"`
-	City    string `json:"city"`
+	Host    string `json:"host"`
 	IP      string `json:"ip"`
 	Port    int    `json:"port"`
 	RealIP  string `json:"real_ip"`
+
+	EntryLocation *GeoLocation `json:"entry_location"`
+	ExitLocation  *GeoLocation `json:"exit_location"`
+	GeoMismatch   bool         `json:"geo_mismatch"`
+
+	ResolvedIPs []string `json:"resolved_ips"`
+
+	FailReason string `json:"fail_reason,omitempty"`
+
+	Anonymity     string   `json:"anonymity"`
+	LeakedHeaders []string `json:"leaked_headers"`
+
+	ConnectAllowed *bool `json:"connect_allowed,omitempty"`
+	AllowedPorts   []int `json:"allowed_ports,omitempty"`
+	Latency
 }
 
 type HistoryItem struct {
-	CheckID    string    `json:"check_id"`
-	CreateAt   time.Time `json:"create_at"`
-	ProxyCount int       `json:"proxy_count"`
+	CheckID       string    `json:"check_id"`
+	CreateAt      time.Time `json:"create_at"`
+	ParentCheckID *string   `json:"parent_check_id,omitempty"`
+	ProxyCount    int       `json:"proxy_count"`
+
+	// Прогресс считается по строкам проверок (proxy_metric), а не по адресам
+	Pending    int `json:"pending"`
+	InProgress int `json:"in_progress"`
+	Checked    int `json:"checked"`
+	Cancelled  int `json:"cancelled"`
+	Working    int `json:"working"`
+}
+
+// HistoryReq - query-параметры GET /proxy/history
+type HistoryReq struct {
+	Cursor string     `form:"cursor"`
+	Limit  int        `form:"limit" binding:"omitempty,min=1,max=500"`
+	From   *time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To     *time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+// HistoryFilter - разобранный HistoryReq для репозитория.
+// After - последний элемент предыдущей страницы, выборка продолжается строго после него.
+type HistoryFilter struct {
+	After *HistoryCursor
+	From  *time.Time
+	To    *time.Time
+	Limit int
+}
+
+type HistoryPage struct {
+	Items []HistoryItem `json:"items"`
+	// NextCursor пуст на последней странице
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// HistoryCursor - позиция в истории для keyset-пагинации по (create_at, check_id)
+type HistoryCursor struct {
+	CreateAt time.Time
+	CheckID  string
+}
+
+// String кодирует курсор в непрозрачную для клиента строку
+func (c HistoryCursor) String() string {
+	raw := c.CreateAt.UTC().Format(time.RFC3339Nano) + "|" + c.CheckID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func ParseHistoryCursor(s string) (HistoryCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return HistoryCursor{}, fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	createAt, checkID, ok := strings.Cut(string(raw), "|")
+	if !ok || uuid.Validate(checkID) != nil {
+		return HistoryCursor{}, fmt.Errorf("invalid cursor")
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, createAt)
+	if err != nil {
+		return HistoryCursor{}, fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	return HistoryCursor{CreateAt: t, CheckID: checkID}, nil
 }
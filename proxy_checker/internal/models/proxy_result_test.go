@@ -0,0 +1,52 @@
+package models
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestHistoryCursorRoundTrip(t *testing.T) {
+	tests := []HistoryCursor{
+		{CreateAt: time.Date(2025, 1, 2, 3, 4, 5, 123456789, time.UTC), CheckID: "82673fed-d401-4c1e-82e9-20f1f7aba941"},
+		{CreateAt: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC), CheckID: "00000000-0000-0000-0000-000000000000"},
+		{CreateAt: time.Date(2025, 1, 2, 6, 4, 5, 0, time.FixedZone("MSK", 3*60*60)), CheckID: "82673fed-d401-4c1e-82e9-20f1f7aba941"},
+	}
+
+	for _, want := range tests {
+		t.Run(want.String(), func(t *testing.T) {
+			got, err := ParseHistoryCursor(want.String())
+			if err != nil {
+				t.Fatalf("ParseHistoryCursor: %v", err)
+			}
+			if !got.CreateAt.Equal(want.CreateAt) || got.CheckID != want.CheckID {
+				t.Errorf("round trip = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseHistoryCursorInvalid(t *testing.T) {
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "not base64", cursor: "not a cursor!"},
+		{name: "no separator", cursor: encode("2025-01-02T03:04:05Z")},
+		{name: "bad check id", cursor: encode("2025-01-02T03:04:05Z|not-a-uuid")},
+		{name: "bad time", cursor: encode("yesterday|82673fed-d401-4c1e-82e9-20f1f7aba941")},
+		{name: "empty", cursor: encode("")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := ParseHistoryCursor(tt.cursor); err == nil {
+				t.Errorf("ParseHistoryCursor(%q) = %+v, want error", tt.cursor, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrTaskNotFound - задачи проверки с таким check_id нет
+	ErrTaskNotFound = errors.New("check task not found")
+	// ErrTaskFinished - в задаче не осталось проверок, которые можно отменить
+	ErrTaskFinished = errors.New("check task already finished")
+	// ErrNotClaimed - проверка больше не принадлежит экземпляру: задачу отменили или аренда истекла,
+	// результат не сохраняется
+	ErrNotClaimed = errors.New("proxy metric is not claimed by this worker")
+)
+
+// ParseCheckID разбирает check_id из запроса. Задачи с некорректным id быть не может, поэтому это ErrTaskNotFound,
+// а не ошибка базы при приведении параметра к uuid
+func ParseCheckID(id string) (uuid.UUID, error) {
+	checkID, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.UUID{}, ErrTaskNotFound
+	}
+	return checkID, nil
+}
+
+// Статусы строки proxy_metric
+const (
+	StatusPending    = "pending"
+	StatusInProgress = "in_progress"
+	StatusChecked    = "checked"
+	StatusCancelled  = "cancelled"
+)
+
+// Состояния задачи проверки целиком
+const (
+	TaskQueued    = "queued"
+	TaskRunning   = "running"
+	TaskDone      = "done"
+	TaskCancelled = "cancelled"
+)
+
+type CancelTaskResponse struct {
+	CheckID string `json:"check_id"`
+	// Cancelled - сколько ожидавших проверок отменено
+	Cancelled int `json:"cancelled"`
+}
+
+// TaskProgress - число проверок задачи по статусам
+type TaskProgress struct {
+	Total      int `json:"total"`
+	Pending    int `json:"pending"`
+	InProgress int `json:"in_progress"`
+	Checked    int `json:"checked"`
+	Cancelled  int `json:"cancelled"`
+	Working    int `json:"working"`
+}
+
+// TaskSummary - ответ GET /proxy/{id}/summary
+type TaskSummary struct {
+	CheckID       string  `json:"check_id"`
+	ParentCheckID *string `json:"parent_check_id"`
+	State         string  `json:"state"`
+	TaskProgress
+
+	Protocols map[string]TaskProgress `json:"protocols"`
+	// Countries - число рабочих адресов по коду страны выхода
+	Countries map[string]int `json:"countries"`
+	// MedianLatencyMs - медиана суммарной задержки рабочих проверок, nil если рабочих нет
+	MedianLatencyMs *int `json:"median_latency_ms"`
+
+	CreateAt   time.Time  `json:"create_at"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
@@ -0,0 +1,95 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/models"
+)
+
+// eventsChannel - канал NOTIFY, через который экземпляры сервиса обмениваются событиями задач
+const eventsChannel = "proxy_events"
+
+// workChannel - канал NOTIFY о новых проверках в очереди, полезной нагрузкой идёт check_id
+const workChannel = "proxy_work"
+
+// listenRetry - пауза перед повторным LISTEN после потери соединения
+const listenRetry = 5 * time.Second
+
+// Publish рассылает событие задачи всем экземплярам сервиса через NOTIFY
+func (p *ProxyRepository) Publish(ctx context.Context, event models.TaskEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.Exec(ctx, notify, eventsChannel, string(payload))
+	return err
+}
+
+// ListenEvents передаёт в handle события, полученные через LISTEN, пока не отменён ctx
+func (p *ProxyRepository) ListenEvents(ctx context.Context, handle func(context.Context, models.TaskEvent) error) {
+	p.listen(ctx, eventsChannel, func(payload string) {
+		var event models.TaskEvent
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			slog.Error(fmt.Sprintf("invalid %s payload: %v", eventsChannel, err))
+			return
+		}
+		if err := handle(ctx, event); err != nil {
+			slog.Error(fmt.Sprintf("handle %s event error: %v", eventsChannel, err))
+		}
+	}, nil)
+}
+
+// ListenWork вызывает notify на каждую новую задачу, пока не отменён ctx.
+// После переподключения notify тоже вызывается: уведомления, пришедшие без LISTEN, потеряны.
+func (p *ProxyRepository) ListenWork(ctx context.Context, notify func()) {
+	p.listen(ctx, workChannel, func(string) {
+		notify()
+	}, notify)
+}
+
+// listen держит отдельное соединение с LISTEN channel и переподключается при его потере.
+// onListen, если задан, вызывается каждый раз, когда LISTEN установлен.
+func (p *ProxyRepository) listen(ctx context.Context, channel string, handle func(payload string), onListen func()) {
+	for ctx.Err() == nil {
+		err := p.listenOnce(ctx, channel, handle, onListen)
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Error(fmt.Sprintf("listen %s error: %v", channel, err))
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(listenRetry):
+		}
+	}
+}
+
+func (p *ProxyRepository) listenOnce(ctx context.Context, channel string, handle func(payload string), onListen func()) error {
+	pooled, err := p.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// соединение в режиме LISTEN забираем из пула насовсем, чтобы его не получил другой запрос
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "listen "+channel); err != nil {
+		return err
+	}
+	if onListen != nil {
+		onListen()
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		handle(notification.Payload)
+	}
+}
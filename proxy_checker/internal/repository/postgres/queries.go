@@ -1,46 +1,288 @@
 package postgres
 
 const (
-	createTaskInTableId = "insert into public.check_table(create_at) values (now()) RETURNING check_id;"
-	createTaskInProxy   = "insert into public.proxy(check_id, ip, port) values ($1, $2, $3) RETURNING proxy_id;"
+	createTaskInTableId = `insert into public.check_table(create_at, options, callback_url, callback_secret, parent_check_id)
+	values (now(), $1, NULLIF($2, ''), $3, $4) RETURNING check_id;`
+	createTaskInProxy = "insert into public.proxy(check_id, host, ip, port, credentials) values ($1, $2, NULLIF($3, '')::inet, $4, $5) RETURNING proxy_id;"
 
 	createTaskInProxyMetric = "insert into public.proxy_metric(check_id, proxy_id, type, status) values ($1, $2, $3, 'pending') returning proxy_metric_id;"
 
-	selectTaskInWork = `select px.proxy_id, ct.check_id, host(px.ip), px.port, pm.proxy_metric_id, pm.type
-		from check_table ct
-			 join proxy px on px.check_id = ct.check_id
-			 join proxy_metric pm on pm.proxy_id = px.proxy_id
-		where pm.status = 'pending'
-		order by ct.check_id, px.ip, px.port
-		for update skip locked;
-		`
+	// claimWork атомарно забирает до $3 адресов прокси со всеми их ожидающими проверками в порядке создания задач.
+	// Блокируется строка proxy, а не отдельные проверки, поэтому проверки одного адреса не делятся между
+	// экземплярами и адрес резолвится и прощупывается один раз. Адреса, уже захваченные другим экземпляром,
+	// пропускаются (skip locked), а захват виден всем сразу после выполнения запроса:
+	// status = 'in_progress' с владельцем и сроком аренды.
+	claimWork = `with picked as (
+		select px.proxy_id
+		from public.proxy px
+		         join public.check_table pt on pt.check_id = px.check_id
+		where exists (select 1
+		              from public.proxy_metric q
+		              where q.proxy_id = px.proxy_id
+		                and q.status = 'pending')
+		order by pt.create_at, px.proxy_id
+		limit $3
+		for no key update of px skip locked
+	),
+	claimed as (
+		update public.proxy_metric pm
+		set status      = 'in_progress',
+		    worker_id   = $1,
+		    lease_until = now() + $2::interval
+		where pm.proxy_id in (select proxy_id from picked)
+		  and pm.status = 'pending'
+		returning pm.proxy_metric_id, pm.proxy_id, pm.check_id, pm.type
+	)
+	select c.proxy_id, c.check_id, px.host, px.port, c.proxy_metric_id, c.type, px.credentials,
+	       COALESCE(ct.options, '{}')
+	from claimed c
+	         join public.proxy px on px.proxy_id = c.proxy_id
+	         join public.check_table ct on ct.check_id = c.check_id
+	order by ct.create_at, px.host, px.port;
+	`
+
+	// extendLease продлевает аренду всех проверок, которые держит экземпляр
+	extendLease = `update public.proxy_metric
+	set lease_until = now() + $2::interval
+	where worker_id = $1
+	  and status = 'in_progress';
+	`
+
+	// releaseExpired возвращает в очередь проверки, чья аренда истекла: экземпляр упал или завис
+	releaseExpired = `update public.proxy_metric
+	set status      = 'pending',
+	    worker_id   = null,
+	    lease_until = null
+	where status = 'in_progress'
+	  and lease_until < now();
+	`
+
+	// releaseWorker возвращает в очередь недоделанные проверки экземпляра, который останавливается
+	releaseWorker = `update public.proxy_metric
+	set status      = 'pending',
+	    worker_id   = null,
+	    lease_until = null
+	where worker_id = $1
+	  and status = 'in_progress';
+	`
 
 	updateProxyMetric = `update public.proxy_metric
 	set type   = $1,
     is_work=$2,
     speed=$3,
-    status='checked'
-	where proxy_metric_id = $4;
+    connect_ms=$4,
+    handshake_ms=$5,
+    tls_ms=$6,
+    ttfb_ms=$7,
+    anonymity=$8,
+    leaked_headers=$9,
+    connect_allowed=$10,
+    allowed_ports=$11,
+    fail_reason=$12,
+    status='checked',
+    checked_at=now(),
+    lease_until=null
+	where proxy_metric_id = $13
+	  and worker_id = $14
+	  and status = 'in_progress';
 	`
 
 	updateProxy = `update public.proxy
-	set city   = $1,
-    real_ip=$2::inet
+	set real_ip=$1::inet,
+    geo_mismatch=$2
 	where proxy_id = $3;
 	`
 
+	upsertProxyLocation = `insert into public.proxy_location(proxy_id, kind, ip, country, country_code, region, region_name,
+	                                   city, zip, lat, lon, timezone, isp, org, asn, as_name)
+	values ($1, $2, $3::inet, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+	on conflict (proxy_id, kind) do update
+	set ip           = excluded.ip,
+	    country      = excluded.country,
+	    country_code = excluded.country_code,
+	    region       = excluded.region,
+	    region_name  = excluded.region_name,
+	    city         = excluded.city,
+	    zip          = excluded.zip,
+	    lat          = excluded.lat,
+	    lon          = excluded.lon,
+	    timezone     = excluded.timezone,
+	    isp          = excluded.isp,
+	    org          = excluded.org,
+	    asn          = excluded.asn,
+	    as_name      = excluded.as_name;
+	`
+
+	// finishTask закрывает задачу ровно один раз: срабатывает только у того, кто сохранил последнюю проверку.
+	// Вместе с завершением ставит в очередь доставку вебхука, если он задан.
+	finishTask = `update public.check_table
+	set finished_at      = now(),
+	    callback_next_at = case when callback_url is not null then now() end
+	where check_id = $1
+	  and finished_at is null
+	  and not exists (select 1 from public.proxy_metric where check_id = $1 and status in ('pending', 'in_progress'))
+	returning check_id;
+	`
+
+	notify = "select pg_notify($1, $2);"
+
+	getTaskOptions = "select COALESCE(options, '{}') from public.check_table where check_id = $1;"
+
+	// getRecheckProxies отбирает адреса задачи с типами их проверок:
+	// working - хотя бы один тип работает, failed - все типы проверены и ни один не работает
+	getRecheckProxies = `
+	select px.host, px.port, px.credentials, array_agg(pm.type order by pm.type)
+	from proxy px
+	         join proxy_metric pm on pm.proxy_id = px.proxy_id
+	where px.check_id = $1
+	group by px.proxy_id
+	having $2::text = 'all'
+	    or ($2::text = 'working' and bool_or(COALESCE(pm.is_work, false)))
+	    or ($2::text = 'failed' and not bool_or(COALESCE(pm.is_work, false)) and bool_and(pm.status = 'checked'))
+	order by px.host, px.port;`
+
+	getCallback = "select COALESCE(callback_url, ''), callback_secret from public.check_table where check_id = $1;"
+
+	insertWebhookAttempt = `insert into public.webhook_attempt(check_id, attempt, url, status_code, error, duration_ms)
+	values ($1, $2, $3, NULLIF($4, 0), NULLIF($5, ''), $6);`
+
+	// claimWebhooks забирает назревшие доставки вебхуков и сдвигает callback_next_at на срок аренды,
+	// чтобы ту же доставку не взял другой экземпляр. Номер попытки продолжает уже сохранённые в webhook_attempt.
+	claimWebhooks = `update public.check_table ct
+	set callback_next_at = now() + $2::interval
+	where ct.check_id in (
+		select check_id
+		from public.check_table
+		where callback_next_at <= now()
+		order by callback_next_at
+		limit $1
+		for update skip locked
+	)
+	returning ct.check_id,
+	          (select COALESCE(max(wa.attempt), 0) + 1 from public.webhook_attempt wa where wa.check_id = ct.check_id);
+	`
+
+	retryWebhook = "update public.check_table set callback_next_at = now() + $2::interval where check_id = $1;"
+
+	finishWebhook = `update public.check_table
+	set callback_next_at      = null,
+	    callback_delivered_at = case when $2::boolean then now() end
+	where check_id = $1;
+	`
+
+	// startTask отмечает начало задачи и сообщает, не отменена ли она; started_at пишется только один раз
+	startTask = `with started as (
+		update public.check_table set started_at = now() where check_id = $1 and started_at is null
+	)
+	select cancelled_at is not null from public.check_table where check_id = $1;
+	`
+
+	lockTask = "select check_id from public.check_table where check_id = $1 for update;"
+
+	cancelTaskMetrics = `update public.proxy_metric
+	set status = 'cancelled', checked_at = now(), lease_until = null
+	where check_id = $1
+	  and status in ('pending', 'in_progress');
+	`
+
+	cancelTask = `update public.check_table
+	set cancelled_at     = now(),
+	    finished_at      = COALESCE(finished_at, now()),
+	    callback_next_at = case when callback_url is not null then now() end
+	where check_id = $1;
+	`
+
+	selectCancelledTasks = "select check_id from public.check_table where check_id = any($1) and cancelled_at is not null;"
+
+	updateProxyAddress = `update public.proxy
+	set ip = $1::inet,
+    resolved_ips=$2::inet[]
+	where proxy_id = $3;
+	`
+
+	// getHistory сначала выбирает страницу задач по индексу (create_at, check_id), и только для неё считает прогресс
 	getHistory = `
-	SELECT ct.check_id, ct.create_at, COUNT(px.proxy_id) as proxy_count
-	FROM check_table ct
-	LEFT JOIN proxy px ON px.check_id = ct.check_id
-	GROUP BY ct.check_id, ct.create_at
-	ORDER BY ct.create_at DESC;`
+	WITH page AS (
+		SELECT check_id, create_at, parent_check_id
+		FROM check_table
+		WHERE ($1::timestamp IS NULL OR create_at >= $1::timestamp)
+		  AND ($2::timestamp IS NULL OR create_at < $2::timestamp)
+		  AND ($3::timestamp IS NULL OR (create_at, check_id) < ($3::timestamp, $4::uuid))
+		ORDER BY create_at DESC, check_id DESC
+		LIMIT $5
+	)
+	SELECT ct.check_id, ct.create_at, ct.parent_check_id, px.proxy_count, pm.pending, pm.in_progress, pm.checked, pm.cancelled, pm.working
+	FROM page ct
+	CROSS JOIN LATERAL (
+		SELECT COUNT(*) AS proxy_count FROM proxy WHERE proxy.check_id = ct.check_id
+	) px
+	CROSS JOIN LATERAL (
+		SELECT COUNT(*) FILTER (WHERE status = 'pending') AS pending,
+		       COUNT(*) FILTER (WHERE status = 'in_progress') AS in_progress,
+		       COUNT(*) FILTER (WHERE status = 'checked') AS checked,
+		       COUNT(*) FILTER (WHERE status = 'cancelled') AS cancelled,
+		       COUNT(*) FILTER (WHERE is_work) AS working
+		FROM proxy_metric WHERE proxy_metric.check_id = ct.check_id
+	) pm
+	ORDER BY ct.create_at DESC, ct.check_id DESC;`
 
 	getStatusProxy = `
-	SELECT ct.check_id, host(px.ip), px.port, COALESCE(px.city, ''), COALESCE(host(px.real_ip), ''),
-	       COALESCE(pm.type, ''), COALESCE(pm.is_work, false), COALESCE(pm.speed, 0), pm.status
+	SELECT ct.check_id, px.host, COALESCE(host(px.ip), ''), px.port, COALESCE(host(px.real_ip), ''),
+	       ARRAY(SELECT host(a) FROM unnest(px.resolved_ips) a),
+	       CASE WHEN el.proxy_id IS NULL THEN NULL ELSE to_jsonb(el) END,
+	       CASE WHEN xl.proxy_id IS NULL THEN NULL ELSE to_jsonb(xl) END,
+	       COALESCE(px.geo_mismatch, false),
+	       COALESCE(pm.type, ''), COALESCE(pm.is_work, false), COALESCE(pm.speed, 0), pm.status,
+	       COALESCE(pm.connect_ms, 0), COALESCE(pm.handshake_ms, 0), COALESCE(pm.tls_ms, 0), COALESCE(pm.ttfb_ms, 0),
+	       COALESCE(pm.anonymity, ''), COALESCE(pm.leaked_headers, '{}'),
+	       pm.connect_allowed, pm.allowed_ports, COALESCE(pm.fail_reason, '')
 	FROM check_table ct
          JOIN proxy px ON px.check_id = ct.check_id
          JOIN proxy_metric pm ON pm.proxy_id = px.proxy_id
+         LEFT JOIN proxy_location el ON el.proxy_id = px.proxy_id AND el.kind = 'entry'
+         LEFT JOIN proxy_location xl ON xl.proxy_id = px.proxy_id AND xl.kind = 'exit'
+	WHERE ct.check_id = $1`
+
+	summaryTask = `
+	SELECT ct.parent_check_id, ct.create_at, ct.started_at, ct.finished_at,
+	       (SELECT round(percentile_cont(0.5) WITHIN GROUP (ORDER BY connect_ms + handshake_ms + tls_ms + ttfb_ms))::int
+	        FROM proxy_metric WHERE check_id = ct.check_id AND is_work)
+	FROM check_table ct
 	WHERE ct.check_id = $1;`
+
+	summaryProtocols = `
+	SELECT COALESCE(type, ''), COUNT(*),
+	       COUNT(*) FILTER (WHERE status = 'pending'),
+	       COUNT(*) FILTER (WHERE status = 'in_progress'),
+	       COUNT(*) FILTER (WHERE status = 'checked'),
+	       COUNT(*) FILTER (WHERE status = 'cancelled'),
+	       COUNT(*) FILTER (WHERE is_work)
+	FROM proxy_metric
+	WHERE check_id = $1
+	GROUP BY type;`
+
+	summaryCountries = `
+	SELECT ` + statusCountry + `, COUNT(*)
+	FROM proxy px
+         LEFT JOIN proxy_location el ON el.proxy_id = px.proxy_id AND el.kind = 'entry'
+         LEFT JOIN proxy_location xl ON xl.proxy_id = px.proxy_id AND xl.kind = 'exit'
+	WHERE px.check_id = $1
+	  AND ` + statusCountry + ` IS NOT NULL
+	  AND EXISTS (SELECT 1 FROM proxy_metric pm WHERE pm.proxy_id = px.proxy_id AND pm.is_work)
+	GROUP BY 1;`
+
+	// statusLatency - суммарная задержка проверки; у неработающих прокси её нет
+	statusLatency = "CASE WHEN pm.is_work THEN pm.connect_ms + pm.handshake_ms + pm.tls_ms + pm.ttfb_ms END"
+	// statusCountry - страна выхода, а если выход не геолоцирован — входа
+	statusCountry = "COALESCE(xl.country_code, el.country_code)"
 )
+
+// statusSort - допустимые значения параметра sort и соответствующий ORDER BY.
+// Скорость сортируется от быстрых к медленным, задержка — от меньшей к большей.
+var statusSort = map[string]string{
+	"speed":   "pm.speed DESC NULLS LAST",
+	"latency": statusLatency + " ASC NULLS LAST",
+	"country": statusCountry + " NULLS LAST",
+	"type":    "pm.type",
+	"host":    "px.host, px.port",
+}
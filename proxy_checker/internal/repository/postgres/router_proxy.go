@@ -2,7 +2,13 @@ package postgres
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/moroshma/proxy_checker/proxy_checker/internal/models"
 )
@@ -15,7 +21,7 @@ func NewProxyRepository(db *pgxpool.Pool) *ProxyRepository {
 	return &ProxyRepository{db: db}
 }
 
-func (p *ProxyRepository) CreateTaskProxy(ctx context.Context, proxy []models.ProxyCheckServiceReq) (models.ProxyCheckServiceResponse, error) {
+func (p *ProxyRepository) CreateTaskProxy(ctx context.Context, proxy []models.ProxyCheckServiceReq, task models.CheckTask) (models.ProxyCheckServiceResponse, error) {
 	var idTask string
 	tx, err := p.db.Begin(ctx)
 	if err != nil {
@@ -23,19 +29,24 @@ func (p *ProxyRepository) CreateTaskProxy(ctx context.Context, proxy []models.Pr
 	}
 	defer tx.Rollback(ctx)
 
-	err = tx.QueryRow(ctx, createTaskInTableId).Scan(&idTask)
+	err = tx.QueryRow(ctx, createTaskInTableId, task.Options, task.Callback.URL, task.Callback.Secret, task.ParentCheckID).Scan(&idTask)
 	if err != nil {
 		return models.ProxyCheckServiceResponse{}, err
 	}
 
 	for _, prx := range proxy {
 		var proxyID string
-		err := tx.QueryRow(ctx, createTaskInProxy, idTask, prx.IP, prx.Port).Scan(&proxyID)
+		err := tx.QueryRow(ctx, createTaskInProxy, idTask, prx.Host, prx.IP, prx.Port, prx.Credentials).Scan(&proxyID)
 		if err != nil {
 			return models.ProxyCheckServiceResponse{}, err
 		}
 
-		for _, proxyType := range []string{"SOCKS5", "HTTP"} {
+		proxyTypes := prx.Types
+		if len(proxyTypes) == 0 {
+			proxyTypes = models.ProxyTypes
+		}
+
+		for _, proxyType := range proxyTypes {
 			_, err = tx.Exec(ctx, createTaskInProxyMetric, idTask, proxyID, proxyType)
 			if err != nil {
 				return models.ProxyCheckServiceResponse{}, err
@@ -43,6 +54,11 @@ func (p *ProxyRepository) CreateTaskProxy(ctx context.Context, proxy []models.Pr
 		}
 	}
 
+	// уведомление уходит слушателям только после коммита, так что чекер не увидит задачу раньше времени
+	if _, err := tx.Exec(ctx, notify, workChannel, idTask); err != nil {
+		return models.ProxyCheckServiceResponse{}, err
+	}
+
 	if err := tx.Commit(ctx); err != nil {
 		return models.ProxyCheckServiceResponse{}, err
 	}
@@ -52,8 +68,9 @@ func (p *ProxyRepository) CreateTaskProxy(ctx context.Context, proxy []models.Pr
 	}, nil
 }
 
-func (p *ProxyRepository) GetStatusProxy(ctx context.Context, checkID string) ([]models.ProxyResultServiceResponse, error) {
-	rows, err := p.db.Query(ctx, getStatusProxy, checkID)
+func (p *ProxyRepository) GetStatusProxy(ctx context.Context, checkID string, filter models.ProxyResultFilter) ([]models.ProxyResultServiceResponse, error) {
+	query, args := statusQuery(checkID, filter)
+	rows, err := p.db.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -63,7 +80,12 @@ func (p *ProxyRepository) GetStatusProxy(ctx context.Context, checkID string) ([
 
 	for rows.Next() {
 		var res models.ProxyResultServiceResponse
-		err := rows.Scan(&res.CheckID, &res.IP, &res.Port, &res.City, &res.RealIP, &res.Type, &res.IsWork, &res.Speed, &res.Status)
+		err := rows.Scan(&res.CheckID, &res.Host, &res.IP, &res.Port, &res.RealIP, &res.ResolvedIPs,
+			&res.EntryLocation, &res.ExitLocation, &res.GeoMismatch,
+			&res.Type, &res.IsWork, &res.Speed, &res.Status,
+			&res.ConnectMs, &res.HandshakeMs, &res.TLSMs, &res.TTFBMs,
+			&res.Anonymity, &res.LeakedHeaders,
+			&res.ConnectAllowed, &res.AllowedPorts, &res.FailReason)
 		if err != nil {
 			return nil, err
 		}
@@ -77,8 +99,61 @@ func (p *ProxyRepository) GetStatusProxy(ctx context.Context, checkID string) ([
 	return results, nil
 }
 
-func (p *ProxyRepository) SelectWork(ctx context.Context) ([]models.Proxy, error) {
-	rows, err := p.db.Query(ctx, selectTaskInWork)
+// statusQuery дописывает к getStatusProxy условия, сортировку и страницу из фильтра.
+// Значения передаются только параметрами, в текст запроса попадают лишь фрагменты из statusSort.
+func statusQuery(checkID string, filter models.ProxyResultFilter) (string, []any) {
+	var sb strings.Builder
+	sb.WriteString(getStatusProxy)
+	args := []any{checkID}
+
+	where := func(cond string, arg any) {
+		args = append(args, arg)
+		fmt.Fprintf(&sb, "\n\t  AND "+cond, len(args))
+	}
+
+	if filter.IsWork != nil {
+		where("COALESCE(pm.is_work, false) = $%d", *filter.IsWork)
+	}
+	if filter.Type != "" {
+		where("pm.type = $%d", filter.Type)
+	}
+	if filter.Status != "" {
+		where("pm.status = $%d", filter.Status)
+	}
+	if filter.Country != "" {
+		where(statusCountry+" = upper($%d)", filter.Country)
+	}
+	if filter.ASN > 0 {
+		where("COALESCE(xl.asn, el.asn) = $%d", filter.ASN)
+	}
+	if filter.MinSpeed > 0 {
+		where("pm.speed >= $%d", filter.MinSpeed)
+	}
+	if filter.MaxLatency > 0 {
+		where(statusLatency+" <= $%d", filter.MaxLatency)
+	}
+
+	sb.WriteString("\n\tORDER BY ")
+	if order, ok := statusSort[filter.Sort]; ok {
+		sb.WriteString(order + ", ")
+	}
+	sb.WriteString("px.host, px.port, pm.type")
+
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		fmt.Fprintf(&sb, "\n\tLIMIT $%d", len(args))
+	}
+	if filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		fmt.Fprintf(&sb, "\n\tOFFSET $%d", len(args))
+	}
+
+	return sb.String(), args
+}
+
+// ClaimWork забирает в аренду до limit адресов прокси со всеми их ожидающими проверками для экземпляра workerID
+func (p *ProxyRepository) ClaimWork(ctx context.Context, workerID string, limit int, lease time.Duration) ([]models.Proxy, error) {
+	rows, err := p.db.Query(ctx, claimWork, workerID, lease, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -88,7 +163,8 @@ func (p *ProxyRepository) SelectWork(ctx context.Context) ([]models.Proxy, error
 
 	for rows.Next() {
 		var res models.Proxy
-		err := rows.Scan(&res.ProxyID, &res.CheckID, &res.IP, &res.Port, &res.ProxyMetricID, &res.Type)
+		err := rows.Scan(&res.ProxyID, &res.CheckID, &res.Host, &res.Port, &res.ProxyMetricID, &res.Type, &res.Credentials,
+			&res.Options)
 		if err != nil {
 			return nil, err
 		}
@@ -102,8 +178,24 @@ func (p *ProxyRepository) SelectWork(ctx context.Context) ([]models.Proxy, error
 	return results, nil
 }
 
-func (p *ProxyRepository) GetHistory(ctx context.Context) ([]models.HistoryItem, error) {
-	rows, err := p.db.Query(ctx, getHistory)
+func (p *ProxyRepository) GetHistory(ctx context.Context, filter models.HistoryFilter) ([]models.HistoryItem, error) {
+	// create_at хранится без часового пояса (в UTC), поэтому границы приводим к UTC
+	var from, to, afterAt *time.Time
+	var afterID *string
+	if filter.From != nil {
+		t := filter.From.UTC()
+		from = &t
+	}
+	if filter.To != nil {
+		t := filter.To.UTC()
+		to = &t
+	}
+	if filter.After != nil {
+		t := filter.After.CreateAt.UTC()
+		afterAt, afterID = &t, &filter.After.CheckID
+	}
+
+	rows, err := p.db.Query(ctx, getHistory, from, to, afterAt, afterID, filter.Limit)
 	if err != nil {
 		return nil, err
 	}
@@ -112,7 +204,7 @@ func (p *ProxyRepository) GetHistory(ctx context.Context) ([]models.HistoryItem,
 	var results []models.HistoryItem
 	for rows.Next() {
 		var res models.HistoryItem
-		err := rows.Scan(&res.CheckID, &res.CreateAt, &res.ProxyCount)
+		err := rows.Scan(&res.CheckID, &res.CreateAt, &res.ParentCheckID, &res.ProxyCount, &res.Pending, &res.InProgress, &res.Checked, &res.Cancelled, &res.Working)
 		if err != nil {
 			return nil, err
 		}
@@ -126,16 +218,274 @@ func (p *ProxyRepository) GetHistory(ctx context.Context) ([]models.HistoryItem,
 	return results, nil
 }
 
+// ExtendLease продлевает аренду проверок экземпляра workerID
+func (p *ProxyRepository) ExtendLease(ctx context.Context, workerID string, lease time.Duration) error {
+	_, err := p.db.Exec(ctx, extendLease, workerID, lease)
+	return err
+}
+
+// ReleaseExpired возвращает в очередь проверки с истёкшей арендой и сообщает их число
+func (p *ProxyRepository) ReleaseExpired(ctx context.Context) (int, error) {
+	tag, err := p.db.Exec(ctx, releaseExpired)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// ReleaseWorker возвращает в очередь проверки, которые держит workerID, и сообщает их число
+func (p *ProxyRepository) ReleaseWorker(ctx context.Context, workerID string) (int, error) {
+	tag, err := p.db.Exec(ctx, releaseWorker, workerID)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// UpdateProxyMetric возвращает models.ErrNotClaimed, если проверку отменили или её аренда ушла другому экземпляру
 func (p *ProxyRepository) UpdateProxyMetric(ctx context.Context, proxyMetric models.ProxyMetric) error {
-	_, err := p.db.Exec(ctx, updateProxyMetric, proxyMetric.Type, proxyMetric.IsWork, proxyMetric.Speed, proxyMetric.ProxyMetricID)
+	tag, err := p.db.Exec(ctx, updateProxyMetric, proxyMetric.Type, proxyMetric.IsWork, proxyMetric.Speed,
+		proxyMetric.ConnectMs, proxyMetric.HandshakeMs, proxyMetric.TLSMs, proxyMetric.TTFBMs,
+		proxyMetric.Anonymity, proxyMetric.LeakedHeaders,
+		proxyMetric.ConnectAllowed, proxyMetric.AllowedPorts, proxyMetric.FailReason, proxyMetric.ProxyMetricID,
+		proxyMetric.WorkerID)
 	if err != nil {
 		return err
 	}
+	if tag.RowsAffected() == 0 {
+		return models.ErrNotClaimed
+	}
 	return nil
 }
 
 func (p *ProxyRepository) UpdateProxy(ctx context.Context, proxyMetric models.Proxy) error {
-	_, err := p.db.Exec(ctx, updateProxy, proxyMetric.City, proxyMetric.RealIP, proxyMetric.ProxyID)
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, updateProxy, proxyMetric.RealIP, proxyMetric.GeoMismatch, proxyMetric.ProxyID)
+	if err != nil {
+		return err
+	}
+
+	locations := map[string]*models.GeoLocation{
+		models.LocationEntry: proxyMetric.EntryLocation,
+		models.LocationExit:  proxyMetric.ExitLocation,
+	}
+	for kind, loc := range locations {
+		if loc == nil {
+			continue
+		}
+		_, err = tx.Exec(ctx, upsertProxyLocation, proxyMetric.ProxyID, kind, loc.IP, loc.Country, loc.CountryCode,
+			loc.Region, loc.RegionName, loc.City, loc.Zip, loc.Lat, loc.Lon, loc.Timezone, loc.ISP, loc.Org, loc.ASN, loc.ASName)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// StartTask запоминает время, когда чекер взял первую проверку задачи, и возвращает true, если задача отменена
+func (p *ProxyRepository) StartTask(ctx context.Context, checkID uuid.UUID) (bool, error) {
+	var cancelled bool
+	err := p.db.QueryRow(ctx, startTask, checkID).Scan(&cancelled)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, models.ErrTaskNotFound
+	}
+	return cancelled, err
+}
+
+// CancelTask отменяет все ожидающие проверки задачи и возвращает их число
+func (p *ProxyRepository) CancelTask(ctx context.Context, checkID string) (int, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var id uuid.UUID
+	err = tx.QueryRow(ctx, lockTask, checkID).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, models.ErrTaskNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	tag, err := tx.Exec(ctx, cancelTaskMetrics, id)
+	if err != nil {
+		return 0, err
+	}
+	cancelled := int(tag.RowsAffected())
+	if cancelled == 0 {
+		return 0, nil
+	}
+
+	if _, err = tx.Exec(ctx, cancelTask, id); err != nil {
+		return 0, err
+	}
+
+	return cancelled, tx.Commit(ctx)
+}
+
+// CancelledTasks возвращает те задачи из checkIDs, которые были отменены
+func (p *ProxyRepository) CancelledTasks(ctx context.Context, checkIDs []uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := p.db.Query(ctx, selectCancelledTasks, checkIDs)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+}
+
+// FinishTask отмечает задачу завершённой, если в ней не осталось ожидающих проверок.
+// Возвращает true только при первом завершении, повторные вызовы ничего не меняют.
+func (p *ProxyRepository) FinishTask(ctx context.Context, checkID uuid.UUID) (bool, error) {
+	var id uuid.UUID
+	err := p.db.QueryRow(ctx, finishTask, checkID).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (p *ProxyRepository) GetTaskOptions(ctx context.Context, checkID string) (models.CheckOptions, error) {
+	var options models.CheckOptions
+	err := p.db.QueryRow(ctx, getTaskOptions, checkID).Scan(&options)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.CheckOptions{}, models.ErrTaskNotFound
+	}
+	return options, err
+}
+
+// GetRecheckProxies возвращает адреса задачи для повторной проверки; учётные данные остаются зашифрованными
+func (p *ProxyRepository) GetRecheckProxies(ctx context.Context, checkID string, filter string) ([]models.ProxyCheckServiceReq, error) {
+	rows, err := p.db.Query(ctx, getRecheckProxies, checkID, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []models.ProxyCheckServiceReq
+	for rows.Next() {
+		var res models.ProxyCheckServiceReq
+		if err := rows.Scan(&res.Host, &res.Port, &res.Credentials, &res.Types); err != nil {
+			return nil, err
+		}
+		results = append(results, res)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func (p *ProxyRepository) GetCallback(ctx context.Context, checkID uuid.UUID) (models.Callback, error) {
+	var callback models.Callback
+	err := p.db.QueryRow(ctx, getCallback, checkID).Scan(&callback.URL, &callback.Secret)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Callback{}, models.ErrTaskNotFound
+	}
+	return callback, err
+}
+
+func (p *ProxyRepository) SaveWebhookAttempt(ctx context.Context, attempt models.WebhookAttempt) error {
+	_, err := p.db.Exec(ctx, insertWebhookAttempt, attempt.CheckID, attempt.Attempt, attempt.URL,
+		attempt.StatusCode, attempt.Error, attempt.DurationMs)
+	return err
+}
+
+// ClaimWebhooks забирает до limit назревших доставок вебхуков в аренду на lease
+func (p *ProxyRepository) ClaimWebhooks(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	rows, err := p.db.Query(ctx, claimWebhooks, limit, lease)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.WebhookDelivery, error) {
+		var delivery models.WebhookDelivery
+		err := row.Scan(&delivery.CheckID, &delivery.Attempt)
+		return delivery, err
+	})
+}
+
+// RetryWebhook переносит доставку вебхука на delay от текущего момента
+func (p *ProxyRepository) RetryWebhook(ctx context.Context, checkID uuid.UUID, delay time.Duration) error {
+	_, err := p.db.Exec(ctx, retryWebhook, checkID, delay)
+	return err
+}
+
+// FinishWebhook снимает доставку вебхука с очереди; delivered отмечает успешную доставку
+func (p *ProxyRepository) FinishWebhook(ctx context.Context, checkID uuid.UUID, delivered bool) error {
+	_, err := p.db.Exec(ctx, finishWebhook, checkID, delivered)
+	return err
+}
+
+func (p *ProxyRepository) GetSummary(ctx context.Context, checkID string) (models.TaskSummary, error) {
+	summary := models.TaskSummary{
+		CheckID:   checkID,
+		Protocols: make(map[string]models.TaskProgress),
+		Countries: make(map[string]int),
+	}
+
+	err := p.db.QueryRow(ctx, summaryTask, checkID).Scan(&summary.ParentCheckID, &summary.CreateAt, &summary.StartedAt,
+		&summary.FinishedAt, &summary.MedianLatencyMs)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.TaskSummary{}, models.ErrTaskNotFound
+	}
+	if err != nil {
+		return models.TaskSummary{}, err
+	}
+
+	rows, err := p.db.Query(ctx, summaryProtocols, checkID)
+	if err != nil {
+		return models.TaskSummary{}, err
+	}
+	for rows.Next() {
+		var proxyType string
+		var progress models.TaskProgress
+		err := rows.Scan(&proxyType, &progress.Total, &progress.Pending, &progress.InProgress,
+			&progress.Checked, &progress.Cancelled, &progress.Working)
+		if err != nil {
+			rows.Close()
+			return models.TaskSummary{}, err
+		}
+		summary.Protocols[proxyType] = progress
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return models.TaskSummary{}, err
+	}
+
+	rows, err = p.db.Query(ctx, summaryCountries, checkID)
+	if err != nil {
+		return models.TaskSummary{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var country string
+		var count int
+		if err := rows.Scan(&country, &count); err != nil {
+			return models.TaskSummary{}, err
+		}
+		summary.Countries[country] = count
+	}
+	if err = rows.Err(); err != nil {
+		return models.TaskSummary{}, err
+	}
+
+	return summary, nil
+}
+
+func (p *ProxyRepository) UpdateProxyAddress(ctx context.Context, proxy models.Proxy) error {
+	_, err := p.db.Exec(ctx, updateProxyAddress, proxy.IP, proxy.ResolvedIPs, proxy.ProxyID)
 	if err != nil {
 		return err
 	}
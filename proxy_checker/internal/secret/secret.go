@@ -0,0 +1,58 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// Box шифрует учётные данные прокси перед сохранением в базу (AES-256-GCM).
+// Ключ шифрования получается из строки конфига через SHA-256, nonce хранится в начале шифротекста.
+type Box struct {
+	aead cipher.AEAD
+}
+
+func NewBox(key string) (*Box, error) {
+	if key == "" {
+		return nil, errors.New("secret key is empty")
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Box{aead: aead}, nil
+}
+
+func (b *Box) Encrypt(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return b.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (b *Box) Decrypt(ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < b.aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+
+	nonce, data := ciphertext[:b.aead.NonceSize()], ciphertext[b.aead.NonceSize():]
+	plaintext, err := b.aead.Open(nil, nonce, data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt: %w", err)
+	}
+
+	return plaintext, nil
+}
@@ -0,0 +1,145 @@
+package secret
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBoxRoundTrip(t *testing.T) {
+	box, err := NewBox("test-key")
+	if err != nil {
+		t.Fatalf("NewBox: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		plaintext []byte
+	}{
+		{name: "credentials", plaintext: []byte("user:p@ss:word")},
+		{name: "empty", plaintext: []byte{}},
+		{name: "binary", plaintext: []byte{0x00, 0xff, 0x10, 0x80}},
+		{name: "long", plaintext: bytes.Repeat([]byte("secret"), 1000)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ciphertext, err := box.Encrypt(tt.plaintext)
+			if err != nil {
+				t.Fatalf("Encrypt: %v", err)
+			}
+			if len(tt.plaintext) > 0 && bytes.Contains(ciphertext, tt.plaintext) {
+				t.Error("ciphertext contains plaintext")
+			}
+
+			got, err := box.Decrypt(ciphertext)
+			if err != nil {
+				t.Fatalf("Decrypt: %v", err)
+			}
+			if !bytes.Equal(got, tt.plaintext) {
+				t.Errorf("Decrypt = %q, want %q", got, tt.plaintext)
+			}
+		})
+	}
+}
+
+// Одинаковые данные шифруются по-разному: nonce случайный для каждого вызова
+func TestBoxEncryptUniqueNonce(t *testing.T) {
+	box, err := NewBox("test-key")
+	if err != nil {
+		t.Fatalf("NewBox: %v", err)
+	}
+
+	first, err := box.Encrypt([]byte("user:pass"))
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	second, err := box.Encrypt([]byte("user:pass"))
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if bytes.Equal(first, second) {
+		t.Error("two encryptions of the same plaintext are equal")
+	}
+}
+
+func TestBoxDecryptErrors(t *testing.T) {
+	box, err := NewBox("test-key")
+	if err != nil {
+		t.Fatalf("NewBox: %v", err)
+	}
+	other, err := NewBox("other-key")
+	if err != nil {
+		t.Fatalf("NewBox: %v", err)
+	}
+
+	ciphertext, err := box.Encrypt([]byte("user:pass"))
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	tamper := func(i int) []byte {
+		c := bytes.Clone(ciphertext)
+		c[i] ^= 0x01
+		return c
+	}
+
+	tests := []struct {
+		name       string
+		box        *Box
+		ciphertext []byte
+	}{
+		{name: "wrong key", box: other, ciphertext: ciphertext},
+		{name: "tampered nonce", box: box, ciphertext: tamper(0)},
+		{name: "tampered data", box: box, ciphertext: tamper(len(ciphertext) / 2)},
+		{name: "tampered tag", box: box, ciphertext: tamper(len(ciphertext) - 1)},
+		{name: "truncated", box: box, ciphertext: ciphertext[:len(ciphertext)-1]},
+		{name: "shorter than nonce", box: box, ciphertext: ciphertext[:4]},
+		{name: "empty", box: box, ciphertext: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := tt.box.Decrypt(tt.ciphertext); err == nil {
+				t.Errorf("Decrypt = %q, want error", got)
+			}
+		})
+	}
+}
+
+// Ключ любой длины приводится к 32 байтам через SHA-256, отвергается только пустой
+func TestNewBoxKeyLength(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{name: "empty", key: "", wantErr: true},
+		{name: "one byte", key: "k"},
+		{name: "aes-128 length", key: strings.Repeat("k", 16)},
+		{name: "longer than aes-256", key: strings.Repeat("k", 100)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			box, err := NewBox(tt.key)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("NewBox returned no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewBox: %v", err)
+			}
+
+			ciphertext, err := box.Encrypt([]byte("user:pass"))
+			if err != nil {
+				t.Fatalf("Encrypt: %v", err)
+			}
+			if got, err := box.Decrypt(ciphertext); err != nil || string(got) != "user:pass" {
+				t.Errorf("Decrypt = %q, %v", got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/models"
+)
+
+func TestParseProxyAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		want    models.ProxyCheckServiceReq
+		wantErr bool
+	}{
+		{
+			name:    "ipv4",
+			address: "1.2.3.4:8080",
+			want:    models.ProxyCheckServiceReq{Host: "1.2.3.4", IP: "1.2.3.4", Port: 8080},
+		},
+		{
+			name:    "hostname",
+			address: "proxy.example.com:3128",
+			want:    models.ProxyCheckServiceReq{Host: "proxy.example.com", Port: 3128},
+		},
+		{
+			name:    "bracketed ipv6",
+			address: "[2001:db8::1]:1080",
+			want:    models.ProxyCheckServiceReq{Host: "2001:db8::1", IP: "2001:db8::1", Port: 1080},
+		},
+		{
+			name:    "credentials",
+			address: "user:p%40ss@1.2.3.4:8080",
+			want:    models.ProxyCheckServiceReq{Host: "1.2.3.4", IP: "1.2.3.4", Port: 8080, Username: "user", Password: "p@ss"},
+		},
+		{
+			name:    "scheme",
+			address: "socks5://1.2.3.4:1080",
+			want:    models.ProxyCheckServiceReq{Host: "1.2.3.4", IP: "1.2.3.4", Port: 1080, Types: []string{models.TypeSOCKS5}},
+		},
+		{
+			name:    "scheme with credentials and ipv6",
+			address: "http://user:pass@[2001:db8::1]:3128",
+			want: models.ProxyCheckServiceReq{
+				Host:     "2001:db8::1",
+				IP:       "2001:db8::1",
+				Port:     3128,
+				Username: "user",
+				Password: "pass",
+				Types:    []string{models.TypeHTTP, models.TypeHTTPS},
+			},
+		},
+		{name: "unbracketed ipv6 with port", address: "2001:db8::1:1080", wantErr: true},
+		{name: "unbracketed ipv6", address: "2001:db8::1", wantErr: true},
+		{name: "unbracketed ipv6 with credentials", address: "user:pass@2001:db8::1:1080", wantErr: true},
+		{name: "unbracketed ipv6 with scheme", address: "socks5://2001:db8::1:1080", wantErr: true},
+		{name: "no port", address: "1.2.3.4", wantErr: true},
+		{name: "empty port", address: "1.2.3.4:", wantErr: true},
+		{name: "port out of range", address: "1.2.3.4:65536", wantErr: true},
+		{name: "non numeric port", address: "1.2.3.4:http", wantErr: true},
+		{name: "unsupported scheme", address: "ftp://1.2.3.4:21", wantErr: true},
+		{name: "empty username", address: ":pass@1.2.3.4:8080", wantErr: true},
+		{name: "path", address: "1.2.3.4:8080/path", wantErr: true},
+		{name: "invalid host", address: "bad_host!:8080", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseProxyAddress(tt.address)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseProxyAddress(%q) = %+v, want error", tt.address, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseProxyAddress(%q): %v", tt.address, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseProxyAddress(%q) =\n%+v\nwant\n%+v", tt.address, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// connectDialer открывает туннель к цели через HTTP CONNECT.
+// В отличие от http.ProxyURL туннель используется для любых запросов, в том числе http://,
+// поэтому проверка HTTPS не зависит от схемы тестовых адресов.
+type connectDialer struct {
+	proxyAddr string
+	username  string
+	password  string
+	forward   *net.Dialer
+}
+
+func (d *connectDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := d.forward.DialContext(ctx, "tcp", d.proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	br, err := connectHandshake(conn, addr, d.username, d.password)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+func connectHandshake(conn net.Conn, addr, username, password string) (*bufio.Reader, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if username != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("connect to %s rejected: %w", addr, &statusError{what: "connect", code: resp.StatusCode})
+	}
+
+	return br, nil
+}
+
+// bufferedConn отдаёт байты, которые прокси прислал сразу за ответом на CONNECT
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// checkConnectPorts пробует CONNECT на каждый порт из конфига и возвращает те, что прокси пропустил
+func (r *CroneChecker) checkConnectPorts(ctx context.Context, addr, username, password string) []int {
+	dialer := &connectDialer{
+		proxyAddr: addr,
+		username:  username,
+		password:  password,
+		forward:   &net.Dialer{Timeout: r.timeout},
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	allowed := make([]int, 0, len(r.httpsCheck.Ports))
+
+	for _, port := range r.httpsCheck.Ports {
+		wg.Add(1)
+		go func(port int) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, r.timeout)
+			defer cancel()
+
+			conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(r.httpsCheck.PortHost, strconv.Itoa(port)))
+			if err != nil {
+				return
+			}
+			conn.Close()
+
+			mu.Lock()
+			allowed = append(allowed, port)
+			mu.Unlock()
+		}(port)
+	}
+	wg.Wait()
+
+	sort.Ints(allowed)
+	return allowed
+}
@@ -3,216 +3,497 @@ package service
 import (
 	"context"
 	"crypto/tls"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"net"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/config"
 	"github.com/moroshma/proxy_checker/proxy_checker/internal/models"
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/secret"
 	"golang.org/x/net/proxy"
 )
 
 type ProxyCronRepositoryI interface {
-	CreateTaskProxy(ctx context.Context, proxy []models.ProxyCheckServiceReq) (models.ProxyCheckServiceResponse, error)
-	GetStatusProxy(ctx context.Context, checkID string) ([]models.ProxyResultServiceResponse, error)
-	GetHistory(ctx context.Context) ([]models.HistoryItem, error)
-	SelectWork(ctx context.Context) ([]models.Proxy, error)
+	CreateTaskProxy(ctx context.Context, proxy []models.ProxyCheckServiceReq, task models.CheckTask) (models.ProxyCheckServiceResponse, error)
+	GetTaskOptions(ctx context.Context, checkID string) (models.CheckOptions, error)
+	GetRecheckProxies(ctx context.Context, checkID string, filter string) ([]models.ProxyCheckServiceReq, error)
+	GetStatusProxy(ctx context.Context, checkID string, filter models.ProxyResultFilter) ([]models.ProxyResultServiceResponse, error)
+	GetHistory(ctx context.Context, filter models.HistoryFilter) ([]models.HistoryItem, error)
+	GetSummary(ctx context.Context, checkID string) (models.TaskSummary, error)
+	StartTask(ctx context.Context, checkID uuid.UUID) (bool, error)
+	CancelTask(ctx context.Context, checkID string) (int, error)
+	CancelledTasks(ctx context.Context, checkIDs []uuid.UUID) ([]uuid.UUID, error)
+	ClaimWork(ctx context.Context, workerID string, limit int, lease time.Duration) ([]models.Proxy, error)
+	ExtendLease(ctx context.Context, workerID string, lease time.Duration) error
+	ReleaseExpired(ctx context.Context) (int, error)
+	ReleaseWorker(ctx context.Context, workerID string) (int, error)
+	ListenWork(ctx context.Context, notify func())
 	UpdateProxyMetric(ctx context.Context, proxyMetric models.ProxyMetric) error
 	UpdateProxy(ctx context.Context, proxyMetric models.Proxy) error
+	UpdateProxyAddress(ctx context.Context, proxy models.Proxy) error
+	FinishTask(ctx context.Context, checkID uuid.UUID) (bool, error)
+	GetCallback(ctx context.Context, checkID uuid.UUID) (models.Callback, error)
+	SaveWebhookAttempt(ctx context.Context, attempt models.WebhookAttempt) error
+	ClaimWebhooks(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error)
+	RetryWebhook(ctx context.Context, checkID uuid.UUID, delay time.Duration) error
+	FinishWebhook(ctx context.Context, checkID uuid.UUID, delivered bool) error
 }
 
+// EventPublisher доставляет события задач потоковым подписчикам
+type EventPublisher interface {
+	Publish(ctx context.Context, event models.TaskEvent) error
+}
+
+// GeoProvider определяет местоположение по IP-адресу
+type GeoProvider interface {
+	Lookup(ctx context.Context, ip string) (models.Location, error)
+}
+
+// CroneChecker разбирает очередь ожидающих проверок.
+// timeout, samples, targetURLs и geolocation берутся из конфига и переопределяются настройками задачи (см. withOptions).
 type CroneChecker struct {
-	repo    ProxyCronRepositoryI
-	timeout time.Duration
+	repo       ProxyCronRepositoryI
+	timeout    time.Duration
+	speedTest  config.SpeedTest
+	judgeURLs  []string
+	judgePort  string
+	httpsCheck config.HTTPSCheck
+	box        *secret.Box
+	geo        GeoProvider
+	events     EventPublisher
+	webhook    *webhookSender
+	tasks      *taskContexts
+	workerID   string
+	queue      config.Queue
+	wake       chan struct{}
+	// inflight - сколько забранных адресов ещё не проверено, freed сигналит, что их стало меньше
+	inflight    *atomic.Int64
+	freed       chan struct{}
+	sniff       bool
+	samples     int
+	targetURLs  []string
+	geolocation bool
+	publicIP    *publicIP
 }
 
-func NewCroneChecker(repo ProxyCronRepositoryI, timeout time.Duration) *CroneChecker {
+func NewCroneChecker(repo ProxyCronRepositoryI, cfg config.Proxy, box *secret.Box, geo GeoProvider, events EventPublisher) *CroneChecker {
 	return &CroneChecker{
-		repo:    repo,
-		timeout: timeout,
+		repo:        repo,
+		timeout:     cfg.Timeout,
+		speedTest:   cfg.SpeedTest,
+		judgeURLs:   cfg.JudgeURLs,
+		judgePort:   cfg.JudgePort,
+		httpsCheck:  cfg.HTTPSCheck,
+		box:         box,
+		geo:         geo,
+		events:      events,
+		webhook:     newWebhookSender(repo, box, cfg.Webhook),
+		tasks:       newTaskContexts(),
+		workerID:    newWorkerID(),
+		queue:       queueConfig(cfg.Queue),
+		wake:        make(chan struct{}, 1),
+		inflight:    &atomic.Int64{},
+		freed:       make(chan struct{}, 1),
+		sniff:       cfg.Sniff,
+		samples:     max(cfg.Samples, 1),
+		targetURLs:  []string{cfg.SpeedTest.URL},
+		geolocation: cfg.Geolocation,
+		publicIP:    &publicIP{static: cfg.PublicIP, url: cfg.PublicIPURL},
 	}
 }
 
-func (r *CroneChecker) Run() {
-	for {
-		proxies, err := r.repo.SelectWork(context.Background())
+// Run разбирает очередь, пока не отменён ctx. После отмены новые проверки не забираются,
+// идущие доделываются не дольше queue.ShutdownGrace, а недоделанные возвращаются в очередь (см. shutdown).
+func (r *CroneChecker) Run(ctx context.Context) {
+	// проверки, аренда и отслеживание отмен переживают ctx: их останавливает abort в shutdown
+	checkCtx, abort := context.WithCancel(context.WithoutCancel(ctx))
+	defer abort()
+
+	go r.watchCancelled(checkCtx)
+	go r.heartbeat(checkCtx)
+	go r.webhook.run(ctx)
+	go r.repo.ListenWork(ctx, r.wakeUp)
+
+	// в jobs не бывает больше queue.Buffer адресов, поэтому отправка в канал не блокируется
+	jobs := make(chan []models.Proxy, r.queue.Buffer)
+	var workers sync.WaitGroup
+	for i := 0; i < r.queue.Workers; i++ {
+		workers.Go(func() {
+			r.worker(ctx, checkCtx, jobs)
+		})
+	}
+
+	// дозабираем работу, когда освободилась хотя бы половина партии, а не по одной строке
+	refill := max(min(r.queue.BatchSize, r.queue.Buffer)/2, 1)
+	for ctx.Err() == nil {
+		free := r.queue.Buffer - int(r.inflight.Load())
+		if free < refill {
+			select {
+			case <-r.freed:
+			case <-ctx.Done():
+			}
+			continue
+		}
+
+		proxies, err := r.repo.ClaimWork(ctx, r.workerID, min(r.queue.BatchSize, free), r.queue.Lease)
 		if err != nil {
-			slog.Error(err.Error())
-			time.Sleep(time.Second * 5)
+			if ctx.Err() == nil {
+				slog.Error(err.Error())
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second * 5):
+			}
 			continue
 		}
 
 		if len(proxies) == 0 {
-			time.Sleep(time.Second * 5)
+			r.waitForWork(ctx)
 			continue
 		}
 
-		jobs := make(chan models.Proxy, len(proxies))
-		var wg sync.WaitGroup
+		groups := groupByProxy(proxies)
+		r.inflight.Add(int64(len(groups)))
+		for _, rows := range groups {
+			jobs <- rows
+		}
+	}
+
+	close(jobs)
+	r.shutdown(&workers, abort)
+}
+
+// worker проверяет адреса из очереди по одному и освобождает место под новую работу.
+// После отмены ctx оставшиеся в очереди адреса не проверяются: shutdown вернёт их в очередь базы.
+func (r *CroneChecker) worker(ctx, checkCtx context.Context, jobs <-chan []models.Proxy) {
+	for rows := range jobs {
+		if ctx.Err() == nil {
+			r.checkProxyGroup(checkCtx, rows)
+		}
+
+		r.inflight.Add(-1)
+		select {
+		case r.freed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// groupByProxy собирает ожидающие строки proxy_metric по адресу прокси, сохраняя порядок выборки
+func groupByProxy(proxies []models.Proxy) [][]models.Proxy {
+	index := make(map[uuid.UUID]int)
+	var groups [][]models.Proxy
+	for _, p := range proxies {
+		i, ok := index[p.ProxyID]
+		if !ok {
+			i = len(groups)
+			index[p.ProxyID] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], p)
+	}
+	return groups
+}
+
+// checkProxyGroup проверяет один адрес прокси по всем его ожидающим типам.
+// Хост резолвится и порт прощупывается один раз, полные проверки запускаются только для распознанных протоколов.
+func (r *CroneChecker) checkProxyGroup(ctx context.Context, rows []models.Proxy) {
+	first := rows[0]
+	ctx, release := r.tasks.acquire(ctx, first.CheckID)
+	defer release()
+	r = r.withOptions(first.Options)
+
+	cancelled, err := r.repo.StartTask(ctx, first.CheckID)
+	if err != nil {
+		slog.Error(fmt.Sprintf("start task error: %v", err))
+	}
+	if cancelled || ctx.Err() != nil {
+		return
+	}
 
-		workers := 10
-		if len(proxies) < workers {
-			workers = len(proxies)
+	ip, resolvedIPs, err := r.resolveHost(ctx, first.Host)
+	if err != nil {
+		r.failGroup(ctx, rows, err)
+		return
+	}
+	if net.ParseIP(first.Host) == nil {
+		first.IP, first.ResolvedIPs = ip, resolvedIPs
+		if err := r.repo.UpdateProxyAddress(ctx, first); err != nil {
+			slog.Error(fmt.Sprintf("update proxy address error: %v", err))
 		}
+	}
 
-		for i := 0; i < workers; i++ {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				for p := range jobs {
-					r.checkProxy(p)
-				}
-			}()
+	var detected map[string]bool
+	if r.sniff {
+		detected, err = r.sniffProtocols(ctx, net.JoinHostPort(ip, first.Port))
+		if err != nil {
+			r.failGroup(ctx, rows, err)
+			return
 		}
+	}
 
-		for _, p := range proxies {
-			jobs <- p
+	for _, p := range rows {
+		if ctx.Err() != nil {
+			return
+		}
+		p.IP, p.ResolvedIPs = ip, resolvedIPs
+		if detected != nil && !detected[p.Type] {
+			r.failMetric(ctx, p, errNotDetected)
+			continue
 		}
-		close(jobs)
+		r.checkProxy(ctx, p)
+	}
+}
 
-		wg.Wait()
-		time.Sleep(time.Second * 5)
+func (r *CroneChecker) failGroup(ctx context.Context, rows []models.Proxy, err error) {
+	for _, p := range rows {
+		r.failMetric(ctx, p, err)
 	}
 }
 
-// TODO: добавить в конфиг отмену контекста
-func (r *CroneChecker) checkProxy(p models.Proxy) {
-	ctx := context.Background()
+// failMetric сохраняет неудачную проверку, до которой дело не дошло из-за ошибки на уровне адреса
+func (r *CroneChecker) failMetric(ctx context.Context, p models.Proxy, err error) {
+	slog.Debug(fmt.Sprintf("proxy %s skipped for %s: %v", p.Type, net.JoinHostPort(p.Host, p.Port), err))
+	r.saveMetric(ctx, p, models.ProxyMetric{
+		ProxyMetricID: p.ProxyMetricID,
+		Type:          p.Type,
+		IsWork:        false,
+		FailReason:    failReason(err, len(p.Credentials) > 0),
+	})
+}
+
+func (r *CroneChecker) checkProxy(ctx context.Context, p models.Proxy) {
 	addr := net.JoinHostPort(p.IP, p.Port)
 
+	var err error
+	if len(p.Credentials) > 0 {
+		p.Username, p.Password, err = r.decryptCredentials(p.Credentials)
+	}
+
 	var client *http.Client
-	var speed int
-	var ok bool
+	if err == nil {
+		client, err = r.proxyClient(p, addr)
+	}
 
-	switch p.Type {
-	case "SOCKS5":
-		client, speed, ok = r.trySocks5(addr)
-	case "HTTP":
-		client, speed, ok = r.tryHTTP(addr)
+	var speed int
+	var latency models.Latency
+	switch {
+	case err != nil:
+	// HTTPS работает, если прошёл TLS-запрос к https_check.url через туннель, задержки берутся с него же.
+	// Замер скорости для HTTPS не обязателен: многие прокси разрешают CONNECT только на 443,
+	// а тестовый файл может лежать на http.
+	case p.Type == models.TypeHTTPS:
+		latency, err = traceRequest(ctx, client, r.httpsCheck.URL)
+		if err == nil {
+			var speedErr error
+			speed, _, speedErr = r.measureSamples(ctx, client)
+			if speedErr != nil {
+				slog.Debug(fmt.Sprintf("speed test through CONNECT failed for %s: %v", addr, speedErr))
+			}
+		}
 	default:
-		ok = false
+		speed, latency, err = r.measureSamples(ctx, client)
 	}
 
-	if !ok {
-		slog.Error(fmt.Sprintf("proxy %s check failed for %s", p.Type, addr))
-		r.repo.UpdateProxyMetric(ctx, models.ProxyMetric{
-			ProxyMetricID: p.ProxyMetricID,
-			Type:          p.Type,
-			IsWork:        false,
-			Speed:         0,
-		})
-		return
+	var connectAllowed *bool
+	var allowedPorts []int
+	if p.Type == models.TypeHTTPS {
+		allowedPorts = r.checkConnectPorts(ctx, addr, p.Username, p.Password)
+		allowed := err == nil || len(allowedPorts) > 0
+		connectAllowed = &allowed
 	}
 
-	location, err := r.checkHttpLocation(p.IP)
 	if err != nil {
-		slog.Error(fmt.Sprintf("location error for %s: %v", addr, err))
+		slog.Error(fmt.Sprintf("proxy %s check failed for %s: %v", p.Type, net.JoinHostPort(p.Host, p.Port), err))
+		r.saveMetric(ctx, p, models.ProxyMetric{
+			ProxyMetricID:  p.ProxyMetricID,
+			Type:           p.Type,
+			IsWork:         false,
+			Speed:          0,
+			FailReason:     failReason(err, p.Username != ""),
+			ConnectAllowed: connectAllowed,
+			AllowedPorts:   allowedPorts,
+		})
+		return
 	}
 
 	realIP := p.IP
-	realIPResp, err := client.Get("http://ip-api.com/json/")
-	if err == nil {
-		body, _ := io.ReadAll(realIPResp.Body)
-		realIPResp.Body.Close()
-		var loc models.Location
-		if json.Unmarshal(body, &loc) == nil && loc.Query != "" {
-			realIP = loc.Query
+	var anonymity string
+	var leakedHeaders []string
+
+	judge, err := r.askJudge(ctx, client)
+	if err != nil {
+		slog.Error(fmt.Sprintf("judge error for %s: %v", addr, err))
+	} else {
+		if ip := exitIP(judge); ip != "" {
+			realIP = ip
+		}
+
+		anonymity, leakedHeaders, err = r.checkAnonymity(ctx, judge)
+		if err != nil {
+			slog.Error(fmt.Sprintf("anonymity check error for %s: %v", addr, err))
 		}
 	}
 
-	city := fmt.Sprintf("%s, %s", location.Country, location.City)
+	var location geoResult
+	if r.geolocation {
+		location = r.locate(ctx, p.IP, realIP)
+	}
 
-	err = r.repo.UpdateProxy(ctx, models.Proxy{
-		ProxyID: p.ProxyID,
-		City:    city,
-		RealIP:  realIP,
-	})
+	p.RealIP = realIP
+	p.EntryLocation, p.ExitLocation, p.GeoMismatch = location.entry, location.exit, location.mismatch
+	err = r.repo.UpdateProxy(ctx, p)
 	if err != nil {
 		slog.Error(fmt.Sprintf("update proxy error: %v", err))
 	}
 
-	err = r.repo.UpdateProxyMetric(ctx, models.ProxyMetric{
-		ProxyMetricID: p.ProxyMetricID,
-		Type:          p.Type,
-		IsWork:        true,
-		Speed:         speed,
+	r.saveMetric(ctx, p, models.ProxyMetric{
+		ProxyMetricID:  p.ProxyMetricID,
+		Type:           p.Type,
+		IsWork:         true,
+		Speed:          speed,
+		Latency:        latency,
+		Anonymity:      anonymity,
+		LeakedHeaders:  leakedHeaders,
+		ConnectAllowed: connectAllowed,
+		AllowedPorts:   allowedPorts,
 	})
+}
+
+// saveMetric сохраняет результат проверки, публикует его подписчикам
+// и, если это была последняя незавершённая проверка задачи, публикует завершение задачи и отправляет вебхук
+func (r *CroneChecker) saveMetric(ctx context.Context, p models.Proxy, metric models.ProxyMetric) {
+	// контекст задачи отменяется вместе с задачей, а её ожидающие проверки уже помечены отменёнными,
+	// или при остановке чекера, и тогда недоделанная проверка вернётся в очередь
+	if ctx.Err() != nil {
+		return
+	}
+
+	metric.WorkerID = r.workerID
+	err := r.repo.UpdateProxyMetric(ctx, metric)
+	if errors.Is(err, models.ErrNotClaimed) {
+		slog.Debug(fmt.Sprintf("proxy metric %s not saved: %v", metric.ProxyMetricID, err))
+		return
+	}
 	if err != nil {
 		slog.Error(fmt.Sprintf("update proxy metric error: %v", err))
+		return
+	}
+
+	result := resultOf(p, metric)
+	r.publish(ctx, models.TaskEvent{Type: models.EventResult, CheckID: result.CheckID, Result: &result})
+
+	finished, err := r.repo.FinishTask(ctx, p.CheckID)
+	if err != nil {
+		slog.Error(fmt.Sprintf("finish task error: %v", err))
+		return
+	}
+	if finished {
+		r.publish(ctx, models.TaskEvent{Type: models.EventDone, CheckID: result.CheckID})
+		r.webhook.wakeUp()
 	}
 }
 
-func (r *CroneChecker) trySocks5(addr string) (*http.Client, int, bool) {
-	dialer, err := proxy.SOCKS5("tcp", addr, nil, &net.Dialer{Timeout: r.timeout})
+func (r *CroneChecker) publish(ctx context.Context, event models.TaskEvent) {
+	if err := r.events.Publish(ctx, event); err != nil {
+		slog.Error(fmt.Sprintf("publish %s event error: %v", event.Type, err))
+	}
+}
+
+// proxyClient собирает HTTP-клиент, который ходит через прокси по протоколу проверки
+func (r *CroneChecker) proxyClient(p models.Proxy, addr string) (*http.Client, error) {
+	switch p.Type {
+	case models.TypeSOCKS5:
+		return r.socks5Client(addr, p.Username, p.Password)
+	case models.TypeSOCKS4:
+		return r.socks4Client(addr, p.Username, false), nil
+	case models.TypeSOCKS4A:
+		return r.socks4Client(addr, p.Username, true), nil
+	case models.TypeHTTP:
+		return r.httpClient(addr, p.Username, p.Password), nil
+	case models.TypeHTTPS:
+		return r.connectClient(addr, p.Username, p.Password), nil
+	default:
+		return nil, fmt.Errorf("unknown proxy type %q", p.Type)
+	}
+}
+
+func (r *CroneChecker) socks5Client(addr, username, password string) (*http.Client, error) {
+	var auth *proxy.Auth
+	if username != "" {
+		auth = &proxy.Auth{User: username, Password: password}
+	}
+
+	dialer, err := proxy.SOCKS5("tcp", addr, auth, &net.Dialer{Timeout: r.timeout})
 	if err != nil {
-		return nil, 0, false
+		return nil, err
 	}
+	contextDialer := dialer.(proxy.ContextDialer)
 
 	transport := &http.Transport{
-		DialContext: func(ctx context.Context, network, a string) (net.Conn, error) {
-			return dialer.Dial(network, a)
-		},
+		DialContext:     contextDialer.DialContext,
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 	}
-	client := &http.Client{Transport: transport, Timeout: r.timeout}
+	return &http.Client{Transport: transport, Timeout: r.timeout}, nil
+}
 
-	//speed, ok := r.measureSpeed(client)
-	//if !ok {
-	//	return nil, 0, false
-	//}
+func (r *CroneChecker) socks4Client(addr, userID string, remoteDNS bool) *http.Client {
+	dialer := &socks4Dialer{
+		proxyAddr: addr,
+		userID:    userID,
+		remoteDNS: remoteDNS,
+		forward:   &net.Dialer{Timeout: r.timeout},
+	}
 
-	return client, 1337, true
+	transport := &http.Transport{
+		DialContext:     dialer.DialContext,
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	return &http.Client{Transport: transport, Timeout: r.timeout}
 }
 
-func (r *CroneChecker) tryHTTP(addr string) (*http.Client, int, bool) {
+func (r *CroneChecker) httpClient(addr, username, password string) *http.Client {
 	proxyURL := &url.URL{Scheme: "http", Host: addr}
+	if username != "" {
+		proxyURL.User = url.UserPassword(username, password)
+	}
 	transport := &http.Transport{
 		Proxy:           http.ProxyURL(proxyURL),
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 	}
-	client := &http.Client{Transport: transport, Timeout: r.timeout}
-
-	//speed, ok := r.measureSpeed(client)
-	//if !ok {
-	//	return nil, 0, false
-	//}
-
-	return client, 1337, true
+	return &http.Client{Transport: transport, Timeout: r.timeout}
 }
 
-func (r *CroneChecker) measureSpeed(client *http.Client) (int, bool) {
-	start := time.Now()
-	resp, err := client.Get("http://speedtest.tele2.net/1MB.zip")
-	if err != nil {
-		return 0, false
+func (r *CroneChecker) connectClient(addr, username, password string) *http.Client {
+	dialer := &connectDialer{
+		proxyAddr: addr,
+		username:  username,
+		password:  password,
+		forward:   &net.Dialer{Timeout: r.timeout},
 	}
-	io.Copy(io.Discard, resp.Body)
-	resp.Body.Close()
-	return int(time.Since(start).Milliseconds()), true
-}
 
-func (r *CroneChecker) checkHttpLocation(ip string) (models.Location, error) {
-	resp, err := http.Get("http://ip-api.com/json/" + ip)
-	if err != nil {
-		return models.Location{}, err
-	}
-
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return models.Location{}, err
+	transport := &http.Transport{
+		DialContext:     dialer.DialContext,
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 	}
+	return &http.Client{Transport: transport, Timeout: r.timeout}
+}
 
-	var location models.Location
-	err = json.Unmarshal(body, &location)
+// decryptCredentials расшифровывает сохранённую пару "логин:пароль"
+func (r *CroneChecker) decryptCredentials(credentials []byte) (string, string, error) {
+	plain, err := r.box.Decrypt(credentials)
 	if err != nil {
-		return models.Location{}, err
+		return "", "", fmt.Errorf("unable to decrypt proxy credentials: %w", err)
 	}
 
-	return location, nil
+	username, password, _ := strings.Cut(string(plain), ":")
+	return username, password, nil
 }
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/models"
+)
+
+// errResolve - не удалось разрешить доменное имя прокси
+var errResolve = errors.New("unable to resolve proxy host")
+
+// errNotDetected - прощупывание порта не распознало протокол проверки
+var errNotDetected = errors.New("protocol is not detected on proxy port")
+
+// errProxyAuth - прокси отказал в авторизации либо потребовал её
+var errProxyAuth = errors.New("proxy authentication failed")
+
+// statusError - неожиданный HTTP-статус от прокси или тестового сервера
+type statusError struct {
+	what string
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected %s status: %d", e.what, e.code)
+}
+
+// failReason переводит ошибку проверки в причину отказа для proxy_metric.fail_reason.
+// Отказ в авторизации считается auth_required, если логин не передавался, и auth_failed, если передавался.
+func failReason(err error, withAuth bool) string {
+	if errors.Is(err, errResolve) {
+		return models.FailReasonResolveFailed
+	}
+	if errors.Is(err, errNotDetected) {
+		return models.FailReasonNotDetected
+	}
+	if !isAuthError(err) {
+		return models.FailReasonFailed
+	}
+	if withAuth {
+		return models.FailReasonAuthFailed
+	}
+	return models.FailReasonAuthRequired
+}
+
+func isAuthError(err error) bool {
+	if errors.Is(err, errProxyAuth) {
+		return true
+	}
+
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && statusErr.code == http.StatusProxyAuthRequired {
+		return true
+	}
+
+	// golang.org/x/net/proxy не экспортирует ошибки SOCKS5, остаётся сверять текст
+	msg := err.Error()
+	return strings.Contains(msg, "no acceptable authentication methods") ||
+		strings.Contains(msg, "username/password authentication failed")
+}
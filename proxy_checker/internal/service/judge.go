@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/models"
+)
+
+// publicIPTTL - как долго кешируется собственный внешний IP чекера
+const publicIPTTL = 10 * time.Minute
+
+// proxyHeaders - заголовки, через которые прокси выдаёт себя или адрес клиента
+var proxyHeaders = []string{
+	"Via",
+	"Forwarded",
+	"Forwarded-For",
+	"X-Forwarded",
+	"X-Forwarded-For",
+	"X-Forwarded-Host",
+	"X-Forwarded-Proto",
+	"X-Forwarded-Server",
+	"X-Real-Ip",
+	"X-Client-Ip",
+	"X-Originating-Ip",
+	"X-Cluster-Client-Ip",
+	"X-Proxy-Id",
+	"Client-Ip",
+	"True-Client-Ip",
+	"Proxy-Connection",
+}
+
+// judgeResponse - ответ judge-сервиса в формате httpbin.org/get, его же отдаёт встроенный /judge
+type judgeResponse struct {
+	Origin  string            `json:"origin"`
+	Headers map[string]string `json:"headers"`
+}
+
+// publicIPLimit - сколько байт ответа сервиса внешнего IP читается, адрес заведомо короче
+const publicIPLimit = 64
+
+// publicIP хранит собственный внешний IP чекера, по которому определяются прозрачные прокси.
+// static задаётся в конфиге, иначе адрес запрашивается у url и кешируется.
+type publicIP struct {
+	static    string
+	url       string
+	mu        sync.Mutex
+	ip        string
+	expiresAt time.Time
+}
+
+// askJudge опрашивает judge-сервисы по порядку и возвращает ответ первого доступного
+func (r *CroneChecker) askJudge(ctx context.Context, client *http.Client) (judgeResponse, error) {
+	judgeURLs, err := r.judges(ctx)
+	if err != nil {
+		return judgeResponse{}, err
+	}
+
+	var errs []error
+	for _, judgeURL := range judgeURLs {
+		judge, err := requestJudge(ctx, client, judgeURL)
+		if err == nil {
+			return judge, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", judgeURL, err))
+	}
+
+	return judgeResponse{}, errors.Join(errs...)
+}
+
+func requestJudge(ctx context.Context, client *http.Client, judgeURL string) (judgeResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, judgeURL, nil)
+	if err != nil {
+		return judgeResponse{}, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return judgeResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return judgeResponse{}, &statusError{what: "judge", code: resp.StatusCode}
+	}
+
+	var judge judgeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&judge); err != nil {
+		return judgeResponse{}, err
+	}
+
+	return judge, nil
+}
+
+// judges возвращает judge-сервисы из конфига, а без них - встроенный /judge этого экземпляра по его внешнему IP
+func (r *CroneChecker) judges(ctx context.Context) ([]string, error) {
+	if len(r.judgeURLs) > 0 {
+		return r.judgeURLs, nil
+	}
+
+	ip, err := r.ownIP(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get own ip for built-in judge: %w", err)
+	}
+	return []string{"http://" + net.JoinHostPort(ip, r.judgePort) + "/judge"}, nil
+}
+
+// ownIP возвращает внешний IP чекера из конфига или от сервиса внешнего IP, запрашивая его не чаще раза в publicIPTTL.
+// Judge для этого не годится: встроенный /judge, запрошенный самим чекером, увидит локальный адрес.
+func (r *CroneChecker) ownIP(ctx context.Context) (string, error) {
+	if r.publicIP.static != "" {
+		return r.publicIP.static, nil
+	}
+
+	r.publicIP.mu.Lock()
+	defer r.publicIP.mu.Unlock()
+
+	if r.publicIP.ip != "" && time.Now().Before(r.publicIP.expiresAt) {
+		return r.publicIP.ip, nil
+	}
+	if r.publicIP.url == "" {
+		return "", errors.New("neither public_ip nor public_ip_url is configured")
+	}
+
+	ip, err := requestPublicIP(ctx, &http.Client{Timeout: r.timeout}, r.publicIP.url)
+	if err != nil {
+		return "", err
+	}
+
+	r.publicIP.ip = ip
+	r.publicIP.expiresAt = time.Now().Add(publicIPTTL)
+	return r.publicIP.ip, nil
+}
+
+// requestPublicIP запрашивает внешний IP напрямую, без прокси; ответом должен быть один адрес текстом
+func requestPublicIP(ctx context.Context, client *http.Client, publicIPURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, publicIPURL, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &statusError{what: "public ip", code: resp.StatusCode}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, publicIPLimit))
+	if err != nil {
+		return "", err
+	}
+	ip := strings.TrimSpace(string(body))
+	if net.ParseIP(ip) == nil {
+		return "", fmt.Errorf("%s returned %q instead of an ip address", publicIPURL, ip)
+	}
+	return ip, nil
+}
+
+// checkAnonymity определяет уровень анонимности прокси по заголовкам, дошедшим до judge
+func (r *CroneChecker) checkAnonymity(ctx context.Context, judge judgeResponse) (string, []string, error) {
+	own, err := r.ownIP(ctx)
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to get own ip: %w", err)
+	}
+
+	anonymity, leaked := classifyAnonymity(judge, own)
+	return anonymity, leaked, nil
+}
+
+// classifyAnonymity раскладывает ответ judge по уровням:
+// transparent - собственный IP чекера виден серверу,
+// anonymous - IP скрыт, но прокси выдаёт себя заголовками,
+// elite - запрос неотличим от прямого.
+func classifyAnonymity(judge judgeResponse, ownIP string) (string, []string) {
+	headers := make(map[string]string, len(judge.Headers))
+	for k, v := range judge.Headers {
+		headers[http.CanonicalHeaderKey(k)] = v
+	}
+
+	own := net.ParseIP(ownIP)
+	leaked := make([]string, 0)
+	transparent := containsIP(judge.Origin, own)
+	for _, name := range proxyHeaders {
+		value, ok := headers[name]
+		if !ok {
+			continue
+		}
+		leaked = append(leaked, name)
+		if containsIP(value, own) {
+			transparent = true
+		}
+	}
+	sort.Strings(leaked)
+
+	switch {
+	case transparent:
+		return models.AnonymityTransparent, leaked
+	// httpbin дописывает X-Forwarded-For от прокси в origin через запятую
+	case len(leaked) > 0 || strings.Contains(judge.Origin, ","):
+		return models.AnonymityAnonymous, leaked
+	default:
+		return models.AnonymityElite, leaked
+	}
+}
+
+// containsIP ищет ip среди адресов в значении заголовка: "a, b" из X-Forwarded-For,
+// "for=a;proto=http, for=\"[b]:port\"" из Forwarded. Адреса сравниваются целиком, а не как подстроки.
+func containsIP(value string, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+
+	for _, entry := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' }) {
+		entry = strings.TrimSpace(entry)
+		if _, v, ok := strings.Cut(entry, "="); ok {
+			entry = strings.TrimSpace(v)
+		}
+		entry = strings.Trim(entry, `"`)
+		if host, _, err := net.SplitHostPort(entry); err == nil {
+			entry = host
+		}
+		entry = strings.TrimSuffix(strings.TrimPrefix(entry, "["), "]")
+
+		if candidate := net.ParseIP(entry); candidate != nil && candidate.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// exitIP возвращает адрес, с которого judge принял соединение, или пустую строку, если origin не IP.
+// httpbin пишет в origin цепочку "X-Forwarded-For, адрес соединения", поэтому берётся последний элемент.
+// Мусор от стороннего judge не пропускается дальше: real_ip пишется в базу как inet.
+func exitIP(judge judgeResponse) string {
+	origin := judge.Origin
+	if i := strings.LastIndex(origin, ","); i >= 0 {
+		origin = origin[i+1:]
+	}
+	ip := net.ParseIP(strings.TrimSpace(origin))
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/models"
+)
+
+func TestExitIP(t *testing.T) {
+	tests := []struct {
+		origin string
+		want   string
+	}{
+		{origin: "203.0.113.7", want: "203.0.113.7"},
+		{origin: "10.0.0.1, 203.0.113.7", want: "203.0.113.7"},
+		{origin: " 203.0.113.7 ", want: "203.0.113.7"},
+		{origin: "2001:db8::7", want: "2001:db8::7"},
+		{origin: "2001:0db8:0000::7", want: "2001:db8::7"},
+		{origin: "a, b", want: ""},
+		{origin: "", want: ""},
+		{origin: "judge.example.net", want: ""},
+		{origin: "203.0.113.7, ", want: ""},
+		{origin: "203.0.113.7:8080", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			if got := exitIP(judgeResponse{Origin: tt.origin}); got != tt.want {
+				t.Errorf("exitIP(%q) = %q, want %q", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyAnonymity(t *testing.T) {
+	const own = "198.51.100.10"
+
+	tests := []struct {
+		name       string
+		judge      judgeResponse
+		want       string
+		wantLeaked []string
+	}{
+		{
+			name:       "no proxy headers",
+			judge:      judgeResponse{Origin: "203.0.113.7", Headers: map[string]string{"Accept": "*/*"}},
+			want:       models.AnonymityElite,
+			wantLeaked: []string{},
+		},
+		{
+			name:       "via only",
+			judge:      judgeResponse{Origin: "203.0.113.7", Headers: map[string]string{"Via": "1.1 squid"}},
+			want:       models.AnonymityAnonymous,
+			wantLeaked: []string{"Via"},
+		},
+		{
+			name:       "forwarded chain in origin",
+			judge:      judgeResponse{Origin: "10.0.0.1, 203.0.113.7"},
+			want:       models.AnonymityAnonymous,
+			wantLeaked: []string{},
+		},
+		{
+			name:       "own ip in x-forwarded-for list",
+			judge:      judgeResponse{Origin: "203.0.113.7", Headers: map[string]string{"x-forwarded-for": "10.0.0.1, 198.51.100.10"}},
+			want:       models.AnonymityTransparent,
+			wantLeaked: []string{"X-Forwarded-For"},
+		},
+		{
+			name:       "own ip in origin",
+			judge:      judgeResponse{Origin: "198.51.100.10, 203.0.113.7"},
+			want:       models.AnonymityTransparent,
+			wantLeaked: []string{},
+		},
+		{
+			name:       "prefix near miss",
+			judge:      judgeResponse{Origin: "203.0.113.7", Headers: map[string]string{"X-Forwarded-For": "198.51.100.101", "Via": "1.1 proxy"}},
+			want:       models.AnonymityAnonymous,
+			wantLeaked: []string{"Via", "X-Forwarded-For"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, leaked := classifyAnonymity(tt.judge, own)
+			if got != tt.want || !slices.Equal(leaked, tt.wantLeaked) {
+				t.Errorf("classifyAnonymity() = (%s, %v), want (%s, %v)", got, leaked, tt.want, tt.wantLeaked)
+			}
+		})
+	}
+}
+
+func TestContainsIP(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		ip    string
+		want  bool
+	}{
+		{name: "single", value: "1.2.3.4", ip: "1.2.3.4", want: true},
+		{name: "x-forwarded-for list", value: "10.0.0.1, 1.2.3.4, 172.16.0.1", ip: "1.2.3.4", want: true},
+		{name: "x-forwarded-for last", value: "10.0.0.1,1.2.3.4", ip: "1.2.3.4", want: true},
+		{name: "prefix near miss", value: "1.2.3.45", ip: "1.2.3.4", want: false},
+		{name: "suffix near miss", value: "11.2.3.4", ip: "1.2.3.4", want: false},
+		{name: "near miss in list", value: "10.0.0.1, 1.2.3.45", ip: "1.2.3.4", want: false},
+		{name: "ip with port", value: "1.2.3.4:5678", ip: "1.2.3.4", want: true},
+		{name: "forwarded ipv4", value: "for=1.2.3.4;proto=http;by=203.0.113.1", ip: "1.2.3.4", want: true},
+		{name: "forwarded quoted ipv6 with port", value: `for="[2001:db8::1]:4711"`, ip: "2001:db8::1", want: true},
+		{name: "forwarded ipv6 in list", value: `for=192.0.2.43, for="[2001:db8:cafe::17]"`, ip: "2001:db8:cafe::17", want: true},
+		{name: "forwarded ipv6 other address", value: `for="[2001:db8::10]:4711"`, ip: "2001:db8::1", want: false},
+		{name: "ipv6 non canonical", value: "2001:0db8:0:0::1", ip: "2001:db8::1", want: true},
+		{name: "via", value: "1.1 squid (squid/6.6)", ip: "1.2.3.4", want: false},
+		{name: "empty value", value: "", ip: "1.2.3.4", want: false},
+		{name: "unknown own ip", value: "1.2.3.4", ip: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := containsIP(tt.value, net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("containsIP(%q, %s) = %v, want %v", tt.value, tt.ip, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/models"
+)
+
+// geoResult - геолокация точки входа (адрес, к которому подключается чекер) и точки выхода (адрес, который видит judge).
+// Если поиск не удался, соответствующее поле остаётся nil.
+type geoResult struct {
+	entry    *models.GeoLocation
+	exit     *models.GeoLocation
+	mismatch bool
+}
+
+// locate определяет местоположение входа и выхода прокси.
+// У шлюзов и цепочек прокси они различаются, тогда выставляется mismatch.
+// Если адреса совпадают, поиск делается один раз.
+func (r *CroneChecker) locate(ctx context.Context, entryIP, exitIP string) geoResult {
+	entry := r.lookupLocation(ctx, entryIP)
+	if exitIP == "" || exitIP == entryIP {
+		return geoResult{entry: entry, exit: entry}
+	}
+
+	exit := r.lookupLocation(ctx, exitIP)
+	return geoResult{
+		entry: entry,
+		exit:  exit,
+		mismatch: entry != nil && exit != nil &&
+			(entry.CountryCode != exit.CountryCode || entry.City != exit.City),
+	}
+}
+
+func (r *CroneChecker) lookupLocation(ctx context.Context, ip string) *models.GeoLocation {
+	location, err := r.geo.Lookup(ctx, ip)
+	if errors.Is(err, models.ErrGeoDisabled) {
+		return nil
+	}
+	if err != nil {
+		slog.Error(fmt.Sprintf("location error for %s: %v", ip, err))
+		return nil
+	}
+
+	asn, asName := parseAS(location.As)
+	return &models.GeoLocation{
+		IP:          ip,
+		Country:     location.Country,
+		CountryCode: location.CountryCode,
+		Region:      location.Region,
+		RegionName:  location.RegionName,
+		City:        location.City,
+		Zip:         location.Zip,
+		Lat:         location.Lat,
+		Lon:         location.Lon,
+		Timezone:    location.Timezone,
+		ISP:         location.Isp,
+		Org:         location.Org,
+		ASN:         asn,
+		ASName:      asName,
+	}
+}
+
+// parseAS разбирает автономную систему в формате ip-api "AS15169 Google LLC" на номер и название
+func parseAS(as string) (int, string) {
+	number, name, _ := strings.Cut(as, " ")
+	asn, err := strconv.Atoi(strings.TrimPrefix(number, "AS"))
+	if err != nil {
+		return 0, as
+	}
+	return asn, name
+}
@@ -0,0 +1,27 @@
+package service
+
+import "testing"
+
+func TestParseAS(t *testing.T) {
+	tests := []struct {
+		as       string
+		wantASN  int
+		wantName string
+	}{
+		{as: "AS15169 Google LLC", wantASN: 15169, wantName: "Google LLC"},
+		{as: "AS64496 Example Net", wantASN: 64496, wantName: "Example Net"},
+		{as: "AS13335", wantASN: 13335, wantName: ""},
+		{as: "", wantASN: 0, wantName: ""},
+		{as: "Google LLC", wantASN: 0, wantName: "Google LLC"},
+		{as: "ASX Broken", wantASN: 0, wantName: "ASX Broken"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.as, func(t *testing.T) {
+			asn, name := parseAS(tt.as)
+			if asn != tt.wantASN || name != tt.wantName {
+				t.Errorf("parseAS(%q) = (%d, %q), want (%d, %q)", tt.as, asn, name, tt.wantASN, tt.wantName)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/models"
+)
+
+const (
+	maxTaskTimeout = time.Minute
+	maxTaskSamples = 20
+)
+
+// normalizeOptions проверяет настройки задачи и приводит названия протоколов к виду models.ProxyTypes
+func normalizeOptions(options models.CheckOptions) (models.CheckOptions, error) {
+	protocols := make([]string, 0, len(options.Protocols))
+	for _, protocol := range options.Protocols {
+		protocol = strings.ToUpper(protocol)
+		if !slices.Contains(models.ProxyTypes, protocol) {
+			return models.CheckOptions{}, fmt.Errorf("unsupported protocol: %s", protocol)
+		}
+		if !slices.Contains(protocols, protocol) {
+			protocols = append(protocols, protocol)
+		}
+	}
+	options.Protocols = protocols
+
+	if options.TimeoutMs < 0 || time.Duration(options.TimeoutMs)*time.Millisecond > maxTaskTimeout {
+		return models.CheckOptions{}, fmt.Errorf("incorrect timeout_ms: %d, max is %d", options.TimeoutMs, maxTaskTimeout.Milliseconds())
+	}
+	if options.Samples < 0 || options.Samples > maxTaskSamples {
+		return models.CheckOptions{}, fmt.Errorf("incorrect samples: %d, max is %d", options.Samples, maxTaskSamples)
+	}
+
+	for _, target := range options.TargetURLs {
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return models.CheckOptions{}, fmt.Errorf("incorrect target url: %s", target)
+		}
+	}
+
+	return options, nil
+}
+
+// selectTypes пересекает типы из схемы адреса с протоколами задачи.
+// Пустой список с любой стороны означает "без ограничений".
+func selectTypes(addressTypes, protocols []string) []string {
+	types := addressTypes
+	if len(types) == 0 {
+		types = models.ProxyTypes
+	}
+	if len(protocols) == 0 {
+		return types
+	}
+
+	selected := make([]string, 0, len(types))
+	for _, t := range types {
+		if slices.Contains(protocols, t) {
+			selected = append(selected, t)
+		}
+	}
+	return selected
+}
+
+// withOptions возвращает копию чекера, в которой настройки задачи наложены на настройки из конфига
+func (r *CroneChecker) withOptions(options models.CheckOptions) *CroneChecker {
+	checker := *r
+	if options.TimeoutMs > 0 {
+		checker.timeout = time.Duration(options.TimeoutMs) * time.Millisecond
+	}
+	if options.Samples > 0 {
+		checker.samples = options.Samples
+	}
+	if len(options.TargetURLs) > 0 {
+		checker.targetURLs = options.TargetURLs
+	}
+	if options.Geolocation != nil {
+		checker.geolocation = *options.Geolocation
+	}
+	return &checker
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/config"
+)
+
+// releaseTimeout ограничивает возврат проверок в очередь при остановке, когда ctx чекера уже отменён
+const releaseTimeout = 5 * time.Second
+
+// queueConfig подставляет минимальные значения, без которых пул не заработает или тикеры упадут
+func queueConfig(cfg config.Queue) config.Queue {
+	cfg.Workers = max(cfg.Workers, 1)
+	cfg.Buffer = max(cfg.Buffer, cfg.Workers)
+	cfg.BatchSize = max(cfg.BatchSize, 1)
+	cfg.Heartbeat = max(cfg.Heartbeat, time.Second)
+	cfg.Lease = max(cfg.Lease, 2*cfg.Heartbeat)
+	cfg.PollInterval = max(cfg.PollInterval, time.Second)
+	return cfg
+}
+
+// newWorkerID - имя экземпляра чекера в proxy_metric.worker_id: по нему видно, кто держит проверку
+func newWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), uuid.NewString()[:8])
+}
+
+// heartbeat продлевает аренду проверок этого экземпляра и возвращает в очередь проверки с истёкшей арендой,
+// в том числе оставшиеся от упавших экземпляров
+func (r *CroneChecker) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(r.queue.Heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := r.repo.ExtendLease(ctx, r.workerID, r.queue.Lease); err != nil {
+			slog.Error(fmt.Sprintf("extend lease error: %v", err))
+		}
+
+		released, err := r.repo.ReleaseExpired(ctx)
+		if err != nil {
+			slog.Error(fmt.Sprintf("release expired leases error: %v", err))
+			continue
+		}
+		if released > 0 {
+			slog.Warn(fmt.Sprintf("%d proxy checks with expired lease returned to queue", released))
+			r.wakeUp()
+		}
+	}
+}
+
+// wakeUp будит Run, если тот ждёт работу; повторные сигналы до пробуждения схлопываются в один
+func (r *CroneChecker) wakeUp() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// waitForWork ждёт NOTIFY о новой задаче. Опрос раз в PollInterval остаётся страховкой на случай,
+// если уведомление потерялось, пока соединение с LISTEN переподключалось.
+func (r *CroneChecker) waitForWork(ctx context.Context) {
+	timer := time.NewTimer(r.queue.PollInterval)
+	defer timer.Stop()
+
+	select {
+	case <-r.wake:
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// shutdown ждёт воркеров и доставку вебхуков не дольше ShutdownGrace, затем прерывает оставшиеся проверки
+// и возвращает в очередь всё, что экземпляр забрал, но не успел проверить
+func (r *CroneChecker) shutdown(workers *sync.WaitGroup, abort context.CancelFunc) {
+	slog.Info("Stopping the checker...")
+
+	graceCtx, cancel := context.WithTimeout(context.Background(), r.queue.ShutdownGrace)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-graceCtx.Done():
+		slog.Warn("shutdown grace period expired, aborting in-flight checks")
+		abort()
+		<-done
+	}
+	r.webhook.shutdown(graceCtx)
+	// останавливает продление аренды, чтобы оно не пересеклось с возвратом проверок в очередь
+	abort()
+
+	ctx, cancelRelease := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancelRelease()
+	released, err := r.repo.ReleaseWorker(ctx, r.workerID)
+	if err != nil {
+		slog.Error(fmt.Sprintf("release proxy checks error: %v", err))
+		return
+	}
+	if released > 0 {
+		slog.Info(fmt.Sprintf("%d unfinished proxy checks returned to queue", released))
+	}
+}
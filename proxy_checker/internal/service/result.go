@@ -0,0 +1,42 @@
+package service
+
+import (
+	"strconv"
+
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/models"
+)
+
+// resultOf собирает результат проверки в том же виде, в каком его отдаёт GET /proxy/{id}
+func resultOf(p models.Proxy, metric models.ProxyMetric) models.ProxyResultServiceResponse {
+	port, _ := strconv.Atoi(p.Port)
+	leakedHeaders := metric.LeakedHeaders
+	if leakedHeaders == nil {
+		leakedHeaders = []string{}
+	}
+	resolvedIPs := p.ResolvedIPs
+	if resolvedIPs == nil {
+		resolvedIPs = []string{}
+	}
+
+	return models.ProxyResultServiceResponse{
+		CheckID:        p.CheckID.String(),
+		Type:           metric.Type,
+		IsWork:         metric.IsWork,
+		Speed:          metric.Speed,
+		Status:         models.StatusChecked,
+		Host:           p.Host,
+		IP:             p.IP,
+		Port:           port,
+		RealIP:         p.RealIP,
+		EntryLocation:  p.EntryLocation,
+		ExitLocation:   p.ExitLocation,
+		GeoMismatch:    p.GeoMismatch,
+		ResolvedIPs:    resolvedIPs,
+		FailReason:     metric.FailReason,
+		Anonymity:      metric.Anonymity,
+		LeakedHeaders:  leakedHeaders,
+		ConnectAllowed: metric.ConnectAllowed,
+		AllowedPorts:   metric.AllowedPorts,
+		Latency:        metric.Latency,
+	}
+}
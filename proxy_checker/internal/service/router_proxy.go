@@ -3,53 +3,94 @@ package service
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"net"
-	"strconv"
+	"net/url"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/moroshma/proxy_checker/proxy_checker/internal/models"
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/secret"
 )
 
 type ProxyApiRepositoryI interface {
-	CreateTaskProxy(ctx context.Context, proxy []models.ProxyCheckServiceReq) (models.ProxyCheckServiceResponse, error)
-	GetStatusProxy(ctx context.Context, checkID string) ([]models.ProxyResultServiceResponse, error)
-	GetHistory(ctx context.Context) ([]models.HistoryItem, error)
-	SelectWork(ctx context.Context) ([]models.Proxy, error)
+	CreateTaskProxy(ctx context.Context, proxy []models.ProxyCheckServiceReq, task models.CheckTask) (models.ProxyCheckServiceResponse, error)
+	GetTaskOptions(ctx context.Context, checkID string) (models.CheckOptions, error)
+	GetRecheckProxies(ctx context.Context, checkID string, filter string) ([]models.ProxyCheckServiceReq, error)
+	GetStatusProxy(ctx context.Context, checkID string, filter models.ProxyResultFilter) ([]models.ProxyResultServiceResponse, error)
+	GetHistory(ctx context.Context, filter models.HistoryFilter) ([]models.HistoryItem, error)
+	GetSummary(ctx context.Context, checkID string) (models.TaskSummary, error)
+	StartTask(ctx context.Context, checkID uuid.UUID) (bool, error)
+	CancelTask(ctx context.Context, checkID string) (int, error)
+	CancelledTasks(ctx context.Context, checkIDs []uuid.UUID) ([]uuid.UUID, error)
+	ClaimWork(ctx context.Context, workerID string, limit int, lease time.Duration) ([]models.Proxy, error)
+	ExtendLease(ctx context.Context, workerID string, lease time.Duration) error
+	ReleaseExpired(ctx context.Context) (int, error)
+	ReleaseWorker(ctx context.Context, workerID string) (int, error)
+	ListenWork(ctx context.Context, notify func())
 	UpdateProxyMetric(ctx context.Context, proxyMetric models.ProxyMetric) error
 	UpdateProxy(ctx context.Context, proxyMetric models.Proxy) error
+	UpdateProxyAddress(ctx context.Context, proxy models.Proxy) error
+	FinishTask(ctx context.Context, checkID uuid.UUID) (bool, error)
+	GetCallback(ctx context.Context, checkID uuid.UUID) (models.Callback, error)
+	SaveWebhookAttempt(ctx context.Context, attempt models.WebhookAttempt) error
+	ClaimWebhooks(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error)
+	RetryWebhook(ctx context.Context, checkID uuid.UUID, delay time.Duration) error
+	FinishWebhook(ctx context.Context, checkID uuid.UUID, delivered bool) error
 }
 
 type ProxyService struct {
-	repo ProxyApiRepositoryI
+	repo   ProxyApiRepositoryI
+	box    *secret.Box
+	events EventPublisher
 }
 
-func NewResumeService(repo ProxyApiRepositoryI) *ProxyService {
+func NewResumeService(repo ProxyApiRepositoryI, box *secret.Box, events EventPublisher) *ProxyService {
 	return &ProxyService{
-		repo: repo,
+		repo:   repo,
+		box:    box,
+		events: events,
 	}
 }
 
 func (r *ProxyService) CreateTaskProxy(ctx context.Context, proxy models.ProxyCheckApiModelRes) (models.ProxyCheckServiceResponse, error) {
+	var options models.CheckOptions
+	if proxy.Options != nil {
+		options = *proxy.Options
+	}
+	options, err := normalizeOptions(options)
+	if err != nil {
+		return models.ProxyCheckServiceResponse{}, err
+	}
+
 	pr := make([]models.ProxyCheckServiceReq, 0, len(proxy.ProxyAddress))
 	for _, v := range proxy.ProxyAddress {
-		host, port, err := net.SplitHostPort(v)
+		req, err := parseProxyAddress(v)
 		if err != nil {
-			return models.ProxyCheckServiceResponse{}, fmt.Errorf("incorrect format ip:port - %v", err)
+			return models.ProxyCheckServiceResponse{}, err
 		}
-		if net.ParseIP(host) == nil {
-			return models.ProxyCheckServiceResponse{}, fmt.Errorf("incorrect IP-address: %s", host)
+
+		req.Types = selectTypes(req.Types, options.Protocols)
+		if len(req.Types) == 0 {
+			return models.ProxyCheckServiceResponse{}, fmt.Errorf("no protocols to check for %s", v)
 		}
-		p, err := strconv.Atoi(port)
-		if err != nil || p < 0 || p > 65535 {
-			return models.ProxyCheckServiceResponse{}, fmt.Errorf("incorrect port: %s", port)
+
+		if req.Username != "" {
+			req.Credentials, err = r.box.Encrypt([]byte(req.Username + ":" + req.Password))
+			if err != nil {
+				return models.ProxyCheckServiceResponse{}, fmt.Errorf("unable to encrypt proxy credentials: %w", err)
+			}
 		}
 
-		pr = append(pr, models.ProxyCheckServiceReq{
-			IP:   host,
-			Port: p,
-		})
+		pr = append(pr, req)
+	}
+
+	callback, err := r.callback(proxy.CallbackURL, proxy.CallbackSecret)
+	if err != nil {
+		return models.ProxyCheckServiceResponse{}, err
 	}
 
-	id, err := r.repo.CreateTaskProxy(ctx, pr)
+	id, err := r.repo.CreateTaskProxy(ctx, pr, models.CheckTask{Options: options, Callback: callback})
 	if err != nil {
 		return models.ProxyCheckServiceResponse{}, err
 	}
@@ -59,15 +100,205 @@ func (r *ProxyService) CreateTaskProxy(ctx context.Context, proxy models.ProxyCh
 	}, nil
 }
 
-func (r *ProxyService) GetHistory(ctx context.Context) ([]models.HistoryItem, error) {
-	return r.repo.GetHistory(ctx)
+const (
+	// historyPageSize - размер страницы истории, если limit не задан
+	historyPageSize = 50
+	// historyMaxPageSize - наибольшая страница истории, больший limit урезается
+	historyMaxPageSize = 500
+)
+
+// callback проверяет адрес вебхука и шифрует его секрет
+func (r *ProxyService) callback(callbackURL, callbackSecret string) (models.Callback, error) {
+	if callbackURL == "" {
+		if callbackSecret != "" {
+			return models.Callback{}, fmt.Errorf("callback_secret without callback_url")
+		}
+		return models.Callback{}, nil
+	}
+
+	u, err := url.Parse(callbackURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return models.Callback{}, fmt.Errorf("incorrect callback url: %s", callbackURL)
+	}
+
+	callback := models.Callback{URL: callbackURL}
+	if callbackSecret != "" {
+		callback.Secret, err = r.box.Encrypt([]byte(callbackSecret))
+		if err != nil {
+			return models.Callback{}, fmt.Errorf("unable to encrypt callback secret: %w", err)
+		}
+	}
+	return callback, nil
+}
+
+func (r *ProxyService) GetHistory(ctx context.Context, filter models.HistoryFilter) (models.HistoryPage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = historyPageSize
+	}
+	limit := min(filter.Limit, historyMaxPageSize)
+	filter.Limit = limit
+
+	// Лишний элемент показывает, есть ли следующая страница
+	filter.Limit++
+	items, err := r.repo.GetHistory(ctx, filter)
+	if err != nil {
+		return models.HistoryPage{}, err
+	}
+
+	page := models.HistoryPage{Items: items}
+	if len(items) > limit {
+		page.Items = items[:limit]
+		last := page.Items[limit-1]
+		page.NextCursor = models.HistoryCursor{CreateAt: last.CreateAt, CheckID: last.CheckID}.String()
+	}
+	if page.Items == nil {
+		page.Items = []models.HistoryItem{}
+	}
+
+	return page, nil
 }
 
 func (r *ProxyService) GetStatusProxy(ctx context.Context, proxy models.ProxyResultServiceReq) ([]models.ProxyResultServiceResponse, error) {
-	proxyList, err := r.repo.GetStatusProxy(ctx, proxy.TaskUUID)
+	if _, err := models.ParseCheckID(proxy.TaskUUID); err != nil {
+		return nil, err
+	}
+
+	proxyList, err := r.repo.GetStatusProxy(ctx, proxy.TaskUUID, proxy.ProxyResultFilter)
 	if err != nil {
 		return nil, err
 	}
 
 	return proxyList, nil
 }
+
+func (r *ProxyService) GetSummary(ctx context.Context, checkID string) (models.TaskSummary, error) {
+	if _, err := models.ParseCheckID(checkID); err != nil {
+		return models.TaskSummary{}, err
+	}
+
+	summary, err := r.repo.GetSummary(ctx, checkID)
+	if err != nil {
+		return models.TaskSummary{}, err
+	}
+
+	return summarize(summary), nil
+}
+
+// summarize досчитывает итоги по протоколам и состояние задачи
+func summarize(summary models.TaskSummary) models.TaskSummary {
+	for _, progress := range summary.Protocols {
+		summary.Total += progress.Total
+		summary.Pending += progress.Pending
+		summary.InProgress += progress.InProgress
+		summary.Checked += progress.Checked
+		summary.Cancelled += progress.Cancelled
+		summary.Working += progress.Working
+	}
+
+	summary.State = taskState(summary.TaskProgress, summary.StartedAt != nil)
+	if summary.State != models.TaskDone && summary.State != models.TaskCancelled {
+		summary.FinishedAt = nil
+	}
+
+	return summary
+}
+
+// taskState выводит состояние задачи из счётчиков проверок.
+// Отменённая задача считается отменённой сразу, даже пока дорабатывают уже взятые проверки.
+func taskState(progress models.TaskProgress, started bool) string {
+	switch {
+	case progress.Cancelled > 0:
+		return models.TaskCancelled
+	case progress.Pending+progress.InProgress == 0:
+		return models.TaskDone
+	case !started && progress.InProgress == 0 && progress.Checked == 0:
+		return models.TaskQueued
+	default:
+		return models.TaskRunning
+	}
+}
+
+// CancelTask отменяет ожидающие проверки задачи. Уже идущие проверки прерывает чекер, заметив отмену в базе.
+// Отмена завершает задачу, поэтому подписчики получают событие done, а вебхук — сводку:
+// доставку ставит в очередь сама отмена в базе, отправляет её чекер любого экземпляра.
+func (r *ProxyService) CancelTask(ctx context.Context, checkID string) (models.CancelTaskResponse, error) {
+	if _, err := models.ParseCheckID(checkID); err != nil {
+		return models.CancelTaskResponse{}, err
+	}
+
+	cancelled, err := r.repo.CancelTask(ctx, checkID)
+	if err != nil {
+		return models.CancelTaskResponse{}, err
+	}
+	if cancelled == 0 {
+		return models.CancelTaskResponse{}, models.ErrTaskFinished
+	}
+
+	if err := r.events.Publish(ctx, models.TaskEvent{Type: models.EventDone, CheckID: checkID}); err != nil {
+		slog.Error(fmt.Sprintf("publish %s event error: %v", models.EventDone, err))
+	}
+
+	return models.CancelTaskResponse{CheckID: checkID, Cancelled: cancelled}, nil
+}
+
+// Recheck создаёт новую задачу из адресов существующей, не требуя от клиента присылать их заново.
+// Адреса проверяются по тем же типам, что и в исходной задаче, с учётом protocols из новых настроек.
+func (r *ProxyService) Recheck(ctx context.Context, checkID string, req models.RecheckReq) (models.ProxyCheckServiceResponse, error) {
+	parentID, err := models.ParseCheckID(checkID)
+	if err != nil {
+		return models.ProxyCheckServiceResponse{}, err
+	}
+
+	options, err := r.repo.GetTaskOptions(ctx, checkID)
+	if err != nil {
+		return models.ProxyCheckServiceResponse{}, err
+	}
+	if req.Options != nil {
+		options = *req.Options
+	}
+	options, err = normalizeOptions(options)
+	if err != nil {
+		return models.ProxyCheckServiceResponse{}, err
+	}
+
+	callback, err := r.callback(req.CallbackURL, req.CallbackSecret)
+	if err != nil {
+		return models.ProxyCheckServiceResponse{}, err
+	}
+
+	filter := req.Filter
+	if filter == "" {
+		filter = models.RecheckAll
+	}
+	proxies, err := r.repo.GetRecheckProxies(ctx, checkID, filter)
+	if err != nil {
+		return models.ProxyCheckServiceResponse{}, err
+	}
+
+	pr := make([]models.ProxyCheckServiceReq, 0, len(proxies))
+	for _, req := range proxies {
+		req.Types = selectTypes(req.Types, options.Protocols)
+		if len(req.Types) == 0 {
+			continue
+		}
+		// адрес, к которому подключался прошлый чекер, не переносим: доменное имя резолвится заново
+		if net.ParseIP(req.Host) != nil {
+			req.IP = req.Host
+		}
+		pr = append(pr, req)
+	}
+	if len(pr) == 0 {
+		return models.ProxyCheckServiceResponse{}, fmt.Errorf("no proxies to recheck with filter %s", filter)
+	}
+
+	id, err := r.repo.CreateTaskProxy(ctx, pr, models.CheckTask{Options: options, Callback: callback, ParentCheckID: &parentID})
+	if err != nil {
+		return models.ProxyCheckServiceResponse{}, err
+	}
+
+	return models.ProxyCheckServiceResponse{
+		CheckID:       id.CheckID,
+		ParentCheckID: checkID,
+		ProxyCount:    len(pr),
+	}, nil
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/models"
+)
+
+// sniffProtocols быстро определяет, на каких протоколах отвечает порт прокси, не делая полноценных запросов.
+// Приветствие SOCKS5, запрос SOCKS4 и HTTP CONNECT отправляются параллельно в отдельных соединениях,
+// распознанные протоколы объединяются: один порт может отвечать и SOCKS4, и SOCKS5, и HTTP.
+// HTTP-прокси на бинарные запросы SOCKS часто молчат до таймаута, поэтому последовательные пробы стоили бы им
+// нескольких таймаутов. Ошибка возвращается только если порт недоступен по TCP.
+func (r *CroneChecker) sniffProtocols(ctx context.Context, addr string) (map[string]bool, error) {
+	probes := [][]byte{{0x05, 0x02, 0x00, 0x02}, r.socks4Probe(), r.connectProbe()}
+	replies := make([][]byte, len(probes))
+	errs := make([]error, len(probes))
+
+	var wg sync.WaitGroup
+	for i, probe := range probes {
+		wg.Go(func() {
+			replies[i], errs[i] = r.sniffProbe(ctx, addr, probe)
+		})
+	}
+	wg.Wait()
+
+	detected := make(map[string]bool)
+	reachable := false
+	for i, reply := range replies {
+		if errs[i] != nil {
+			continue
+		}
+		reachable = true
+		for protocol := range classifyGreeting(reply) {
+			detected[protocol] = true
+		}
+	}
+	if !reachable {
+		return nil, errs[0]
+	}
+
+	return detected, nil
+}
+
+// classifyGreeting сопоставляет первые байты ответа с протоколом, nil - протокол не распознан
+func classifyGreeting(reply []byte) map[string]bool {
+	switch {
+	case len(reply) >= 2 && reply[0] == 0x05:
+		return map[string]bool{models.TypeSOCKS5: true}
+	case bytes.HasPrefix(reply, []byte("HTTP/")):
+		return map[string]bool{models.TypeHTTP: true, models.TypeHTTPS: true}
+	case len(reply) >= 2 && reply[0] == 0x00 && reply[1] >= 0x5a && reply[1] <= 0x5d:
+		return map[string]bool{models.TypeSOCKS4: true, models.TypeSOCKS4A: true}
+	default:
+		return nil
+	}
+}
+
+// sniffProbe открывает соединение, отправляет probe и читает то, что сервер успел ответить.
+// Молчание и закрытое соединение не считаются ошибкой - это пустой ответ.
+func (r *CroneChecker) sniffProbe(ctx context.Context, addr string, probe []byte) ([]byte, error) {
+	dialer := &net.Dialer{Timeout: r.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(r.timeout))
+	if _, err := conn.Write(probe); err != nil {
+		return nil, nil
+	}
+
+	buf := make([]byte, 16)
+	n, _ := conn.Read(buf)
+	return buf[:n], nil
+}
+
+// socks4Probe - запрос CONNECT в формате SOCKS4a к хосту проверки портов.
+// Сервер без поддержки 4a всё равно ответит отказом 0x5b, чего достаточно для распознавания.
+func (r *CroneChecker) socks4Probe() []byte {
+	req := []byte{socks4Version, socks4CommandConnect}
+	req = binary.BigEndian.AppendUint16(req, 80)
+	req = append(req, 0, 0, 0, 1, 0)
+	req = append(req, r.httpsCheck.PortHost...)
+	return append(req, 0)
+}
+
+func (r *CroneChecker) connectProbe() []byte {
+	target := net.JoinHostPort(r.httpsCheck.PortHost, "443")
+	return []byte(fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target))
+}
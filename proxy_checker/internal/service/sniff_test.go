@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/config"
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/models"
+)
+
+func TestClassifyGreeting(t *testing.T) {
+	socks5 := map[string]bool{models.TypeSOCKS5: true}
+	socks4 := map[string]bool{models.TypeSOCKS4: true, models.TypeSOCKS4A: true}
+	httpProxy := map[string]bool{models.TypeHTTP: true, models.TypeHTTPS: true}
+
+	tests := []struct {
+		name  string
+		reply []byte
+		want  map[string]bool
+	}{
+		{name: "empty", reply: nil, want: nil},
+		{name: "socks5 no auth", reply: []byte{0x05, 0x00}, want: socks5},
+		{name: "socks5 user pass", reply: []byte{0x05, 0x02}, want: socks5},
+		{name: "socks5 no acceptable methods", reply: []byte{0x05, 0xff}, want: socks5},
+		{name: "socks5 truncated", reply: []byte{0x05}, want: nil},
+		{name: "socks4 granted", reply: []byte{0x00, 0x5a, 0, 80, 0, 0, 0, 0}, want: socks4},
+		{name: "socks4 rejected", reply: []byte{0x00, 0x5b, 0, 0, 0, 0, 0, 0}, want: socks4},
+		{name: "socks4 identd", reply: []byte{0x00, 0x5d}, want: socks4},
+		{name: "socks4 unknown code", reply: []byte{0x00, 0x5e}, want: nil},
+		{name: "http connect established", reply: []byte("HTTP/1.1 200 Connection established\r\n"), want: httpProxy},
+		{name: "http auth required", reply: []byte("HTTP/1.0 407 Proxy Auth"), want: httpProxy},
+		{name: "http lowercase", reply: []byte("http/1.1 200 OK"), want: nil},
+		{name: "ssh banner", reply: []byte("SSH-2.0-OpenSSH_9.6"), want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classifyGreeting(tt.reply)
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("classifyGreeting(%q) = %v, want %v", tt.reply, got, tt.want)
+			}
+		})
+	}
+}
+
+// HTTP-прокси молчит на бинарные пробы SOCKS, но распознаётся по CONNECT за один таймаут, а не за три
+func TestSniffProtocolsHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	const timeout = 300 * time.Millisecond
+	r := &CroneChecker{timeout: timeout, httpsCheck: config.HTTPSCheck{PortHost: "portquiz.net"}}
+
+	start := time.Now()
+	detected, err := r.sniffProtocols(context.Background(), strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatalf("sniffProtocols: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*timeout {
+		t.Errorf("sniffProtocols took %v, want at most one timeout", elapsed)
+	}
+
+	want := map[string]bool{models.TypeHTTP: true, models.TypeHTTPS: true}
+	if !maps.Equal(detected, want) {
+		t.Errorf("detected %v, want %v", detected, want)
+	}
+}
+
+func TestSniffProtocolsUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	r := &CroneChecker{timeout: 300 * time.Millisecond}
+	if _, err := r.sniffProtocols(context.Background(), addr); err == nil {
+		t.Error("sniffProtocols on closed port returned no error")
+	}
+}
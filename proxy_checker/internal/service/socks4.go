@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	socks4Version        = 0x04
+	socks4CommandConnect = 0x01
+	socks4Granted        = 0x5a
+)
+
+// socks4Dialer устанавливает соединение через SOCKS4 или SOCKS4a прокси.
+// В SOCKS4 адрес цели резолвится локально и передаётся как IPv4,
+// в SOCKS4a имя хоста передаётся прокси, и резолвит его уже он.
+type socks4Dialer struct {
+	proxyAddr string
+	userID    string
+	remoteDNS bool
+	forward   *net.Dialer
+}
+
+func (d *socks4Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if network != "tcp" && network != "tcp4" {
+		return nil, fmt.Errorf("socks4: network %s is not supported", network)
+	}
+
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("socks4: incorrect port: %s", portStr)
+	}
+
+	req, err := d.connectRequest(ctx, host, port)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := d.forward.DialContext(ctx, "tcp", d.proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if err := socks4Handshake(conn, req); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	return conn, nil
+}
+
+// connectRequest собирает запрос CONNECT: VN, CD, DSTPORT, DSTIP, USERID, NULL и для 4a — HOST, NULL
+func (d *socks4Dialer) connectRequest(ctx context.Context, host string, port int) ([]byte, error) {
+	req := []byte{socks4Version, socks4CommandConnect}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+
+	ip := net.ParseIP(host).To4()
+	if ip == nil && !d.remoteDNS {
+		ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+		if err != nil {
+			return nil, err
+		}
+		ip = ips[0].To4()
+	}
+
+	if ip != nil {
+		req = append(req, ip...)
+		req = append(req, d.userID...)
+		return append(req, 0), nil
+	}
+
+	// 0.0.0.x с ненулевым x — признак SOCKS4a, адрес цели идёт строкой после USERID
+	req = append(req, 0, 0, 0, 1)
+	req = append(req, d.userID...)
+	req = append(req, 0)
+	req = append(req, host...)
+	return append(req, 0), nil
+}
+
+func socks4Handshake(conn net.Conn, req []byte) error {
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	var reply [8]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return err
+	}
+	if reply[0] != 0 {
+		return fmt.Errorf("socks4: unexpected reply version %d", reply[0])
+	}
+
+	switch reply[1] {
+	case socks4Granted:
+		return nil
+	case 0x5b:
+		return errors.New("socks4: request rejected or failed")
+	case 0x5c:
+		return errors.New("socks4: request rejected, identd is unreachable")
+	case 0x5d:
+		return fmt.Errorf("socks4: request rejected, identd user mismatch: %w", errProxyAuth)
+	default:
+		return fmt.Errorf("socks4: unknown reply code %d", reply[1])
+	}
+}
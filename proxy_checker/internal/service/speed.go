@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"slices"
+	"time"
+
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/models"
+)
+
+// measureSamples повторяет замер samples раз, перебирая тестовые адреса по кругу,
+// и возвращает медианы скорости и задержек по удачным замерам.
+// Каждый замер идёт по новому соединению, иначе задержки подключения были бы нулевыми.
+func (r *CroneChecker) measureSamples(ctx context.Context, client *http.Client) (int, models.Latency, error) {
+	speeds := make([]int, 0, r.samples)
+	latencies := make([]models.Latency, 0, r.samples)
+
+	var lastErr error
+	for i := 0; i < r.samples; i++ {
+		client.CloseIdleConnections()
+
+		speed, latency, err := r.measureSpeed(ctx, client, r.targetURLs[i%len(r.targetURLs)])
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		speeds = append(speeds, speed)
+		latencies = append(latencies, latency)
+	}
+
+	if len(speeds) == 0 {
+		return 0, models.Latency{}, lastErr
+	}
+
+	return median(speeds), medianLatency(latencies), nil
+}
+
+// measureSpeed скачивает тестовый файл через прокси и возвращает скорость в байтах в секунду
+// вместе с разбивкой задержек этого запроса.
+// Загрузка ограничена размером и длительностью из конфига, если за отведённое время
+// файл скачался не полностью, скорость считается по уже полученным байтам.
+func (r *CroneChecker) measureSpeed(ctx context.Context, client *http.Client, target string) (int, models.Latency, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.speedTest.MaxDuration)
+	defer cancel()
+
+	trace := &latencyTrace{}
+	ctx = httptrace.WithClientTrace(ctx, trace.clientTrace())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return 0, models.Latency{}, err
+	}
+
+	// общий таймаут клиента оборвал бы загрузку раньше max_duration
+	speedClient := *client
+	speedClient.Timeout = 0
+
+	resp, err := speedClient.Do(req)
+	if err != nil {
+		return 0, models.Latency{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, models.Latency{}, &statusError{what: "speed test", code: resp.StatusCode}
+	}
+
+	var body io.Reader = resp.Body
+	if r.speedTest.Size > 0 {
+		body = io.LimitReader(resp.Body, r.speedTest.Size)
+	}
+
+	start := time.Now()
+	n, err := io.Copy(io.Discard, body)
+	elapsed := time.Since(start)
+	if err != nil && !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return 0, models.Latency{}, err
+	}
+	if n == 0 || elapsed <= 0 {
+		return 0, models.Latency{}, errors.New("speed test body is empty")
+	}
+
+	return int(float64(n) / elapsed.Seconds()), trace.latency(), nil
+}
+
+func median(values []int) int {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+func medianLatency(latencies []models.Latency) models.Latency {
+	field := func(get func(models.Latency) int) int {
+		values := make([]int, 0, len(latencies))
+		for _, l := range latencies {
+			values = append(values, get(l))
+		}
+		return median(values)
+	}
+
+	return models.Latency{
+		ConnectMs:   field(func(l models.Latency) int { return l.ConnectMs }),
+		HandshakeMs: field(func(l models.Latency) int { return l.HandshakeMs }),
+		TLSMs:       field(func(l models.Latency) int { return l.TLSMs }),
+		TTFBMs:      field(func(l models.Latency) int { return l.TTFBMs }),
+	}
+}
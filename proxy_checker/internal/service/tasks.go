@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// cancelPollInterval - как часто чекер проверяет, не отменены ли задачи, которые он сейчас проверяет
+const cancelPollInterval = 2 * time.Second
+
+// taskContexts раздаёт проверкам общий контекст их задачи, чтобы отмена задачи прерывала уже идущие проверки
+type taskContexts struct {
+	mu    sync.Mutex
+	tasks map[uuid.UUID]*taskContext
+}
+
+type taskContext struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	refs   int
+}
+
+func newTaskContexts() *taskContexts {
+	return &taskContexts{tasks: make(map[uuid.UUID]*taskContext)}
+}
+
+// acquire возвращает контекст задачи; release нужно вызвать, когда проверка закончена
+func (t *taskContexts) acquire(parent context.Context, checkID uuid.UUID) (context.Context, func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	task, ok := t.tasks[checkID]
+	if !ok {
+		ctx, cancel := context.WithCancel(parent)
+		task = &taskContext{ctx: ctx, cancel: cancel}
+		t.tasks[checkID] = task
+	}
+	task.refs++
+
+	var once sync.Once
+	return task.ctx, func() {
+		once.Do(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			task.refs--
+			if task.refs == 0 {
+				task.cancel()
+				delete(t.tasks, checkID)
+			}
+		})
+	}
+}
+
+// active - задачи, проверки которых сейчас идут
+func (t *taskContexts) active() []uuid.UUID {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ids := make([]uuid.UUID, 0, len(t.tasks))
+	for id := range t.tasks {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (t *taskContexts) cancel(checkID uuid.UUID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if task, ok := t.tasks[checkID]; ok {
+		task.cancel()
+	}
+}
+
+// watchCancelled прерывает идущие проверки задач, отменённых через API.
+// Отмена видна через базу, поэтому работает и для задач, отменённых на другом экземпляре сервиса.
+func (r *CroneChecker) watchCancelled(ctx context.Context) {
+	ticker := time.NewTicker(cancelPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		active := r.tasks.active()
+		if len(active) == 0 {
+			continue
+		}
+
+		cancelled, err := r.repo.CancelledTasks(ctx, active)
+		if err != nil {
+			slog.Error(fmt.Sprintf("select cancelled tasks error: %v", err))
+			continue
+		}
+		for _, checkID := range cancelled {
+			slog.Info(fmt.Sprintf("task %s cancelled, aborting its checks", checkID))
+			r.tasks.cancel(checkID)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/models"
+)
+
+// latencyTrace собирает тайминги одного запроса через прокси.
+// Колбэки httptrace вызываются из горутин транспорта, поэтому поля защищены мьютексом.
+type latencyTrace struct {
+	mu           sync.Mutex
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	gotConn      time.Time
+	firstByte    time.Time
+}
+
+func (t *latencyTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		ConnectStart: func(network, addr string) {
+			t.set(&t.connectStart)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err == nil {
+				t.set(&t.connectDone)
+			}
+		},
+		TLSHandshakeStart: func() {
+			t.set(&t.tlsStart)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.set(&t.tlsDone)
+		},
+		GotConn: func(httptrace.GotConnInfo) {
+			t.set(&t.gotConn)
+		},
+		GotFirstResponseByte: func() {
+			t.set(&t.firstByte)
+		},
+	}
+}
+
+// set запоминает только первое срабатывание события
+func (t *latencyTrace) set(field *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if field.IsZero() {
+		*field = time.Now()
+	}
+}
+
+// latency переводит собранные отметки времени в интервалы.
+// Рукопожатие с прокси — это время от установки TCP-соединения до начала TLS
+// (или до готовности соединения, если TLS не используется): SOCKS-согласование либо HTTP CONNECT.
+func (t *latencyTrace) latency() models.Latency {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	handshakeDone := t.gotConn
+	if !t.tlsStart.IsZero() {
+		handshakeDone = t.tlsStart
+	}
+
+	return models.Latency{
+		ConnectMs:   since(t.connectStart, t.connectDone),
+		HandshakeMs: since(t.connectDone, handshakeDone),
+		TLSMs:       since(t.tlsStart, t.tlsDone),
+		TTFBMs:      since(t.gotConn, t.firstByte),
+	}
+}
+
+func since(from, to time.Time) int {
+	if from.IsZero() || to.IsZero() || to.Before(from) {
+		return 0
+	}
+	return int(to.Sub(from).Milliseconds())
+}
+
+// traceRequest выполняет GET через прокси и возвращает разбивку задержек
+func traceRequest(ctx context.Context, client *http.Client, url string) (models.Latency, error) {
+	trace := &latencyTrace{}
+	ctx = httptrace.WithClientTrace(ctx, trace.clientTrace())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return models.Latency{}, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return models.Latency{}, err
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return models.Latency{}, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return models.Latency{}, &statusError{what: "probe", code: resp.StatusCode}
+	}
+
+	return trace.latency(), nil
+}
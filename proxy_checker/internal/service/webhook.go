@@ -0,0 +1,261 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/config"
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/models"
+	"github.com/moroshma/proxy_checker/proxy_checker/internal/secret"
+)
+
+// Заголовки запроса вебхука. Подпись - HMAC-SHA256 тела на callback_secret в hex с префиксом "sha256=".
+const (
+	webhookEventHeader     = "X-Proxy-Checker-Event"
+	webhookSignatureHeader = "X-Proxy-Checker-Signature"
+	webhookAttemptHeader   = "X-Proxy-Checker-Attempt"
+)
+
+// webhookPollInterval - как часто экземпляр ищет назревшие доставки: повторы после неудач
+// и доставки, брошенные упавшими или остановленными экземплярами
+const webhookPollInterval = 2 * time.Second
+
+// webhookBatch - сколько доставок экземпляр забирает за раз
+const webhookBatch = 20
+
+// webhookReleaseTimeout ограничивает возврат прерванной доставки в очередь, когда её контекст уже отменён
+const webhookReleaseTimeout = 5 * time.Second
+
+type webhookRepository interface {
+	GetCallback(ctx context.Context, checkID uuid.UUID) (models.Callback, error)
+	GetSummary(ctx context.Context, checkID string) (models.TaskSummary, error)
+	SaveWebhookAttempt(ctx context.Context, attempt models.WebhookAttempt) error
+	ClaimWebhooks(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error)
+	RetryWebhook(ctx context.Context, checkID uuid.UUID, delay time.Duration) error
+	FinishWebhook(ctx context.Context, checkID uuid.UUID, delivered bool) error
+}
+
+// webhookSender отправляет сводку завершённой задачи на её callback_url.
+// Очередь доставок хранится в check_table.callback_next_at: её заполняет завершение или отмена задачи,
+// неудачная попытка переносит доставку с экспоненциальной паузой. Поэтому доставка переживает
+// падение и остановку экземпляра - её доделает любой экземпляр с чекером.
+type webhookSender struct {
+	repo        webhookRepository
+	box         *secret.Box
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	// lease - на сколько забранная доставка скрыта от других экземпляров
+	lease time.Duration
+	wake  chan struct{}
+	// wg считает идущие доставки, stop прерывает их при остановке
+	wg    sync.WaitGroup
+	stop  context.Context
+	abort context.CancelFunc
+}
+
+func newWebhookSender(repo webhookRepository, box *secret.Box, cfg config.Webhook) *webhookSender {
+	stop, abort := context.WithCancel(context.Background())
+	return &webhookSender{
+		repo:        repo,
+		box:         box,
+		client:      &http.Client{Timeout: cfg.Timeout},
+		maxAttempts: max(cfg.MaxAttempts, 1),
+		backoff:     cfg.Backoff,
+		lease:       max(time.Minute, 2*cfg.Timeout),
+		wake:        make(chan struct{}, 1),
+		stop:        stop,
+		abort:       abort,
+	}
+}
+
+// run забирает назревшие доставки и отправляет их в фоне, пока не отменён ctx
+func (w *webhookSender) run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.wake:
+		case <-timer.C:
+		}
+
+		deliveries, err := w.repo.ClaimWebhooks(ctx, webhookBatch, w.lease)
+		if err != nil && ctx.Err() == nil {
+			slog.Error(fmt.Sprintf("claim webhooks error: %v", err))
+		}
+		for _, delivery := range deliveries {
+			w.wg.Add(1)
+			go func() {
+				defer w.wg.Done()
+				w.deliver(w.stop, delivery)
+			}()
+		}
+
+		// полная партия - значит, назревших доставок может быть больше, забираем сразу
+		if len(deliveries) == webhookBatch {
+			w.wakeUp()
+		}
+		timer.Reset(webhookPollInterval)
+	}
+}
+
+// wakeUp просит run не ждать очередного опроса: у задачи этого экземпляра появилась доставка
+func (w *webhookSender) wakeUp() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// shutdown ждёт идущие доставки, пока не отменён ctx, после чего прерывает оставшиеся.
+// Прерванные доставки остаются в очереди и достаются другим экземплярам.
+func (w *webhookSender) shutdown(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
+	}
+	w.abort()
+	<-done
+}
+
+// deliver делает одну попытку доставки и сохраняет её в webhook_attempt.
+// После неудачи доставка переносится на backoff * 2^(attempt-1), после maxAttempts неудач - снимается.
+func (w *webhookSender) deliver(ctx context.Context, delivery models.WebhookDelivery) {
+	checkID := delivery.CheckID
+	callback, err := w.repo.GetCallback(ctx, checkID)
+	if err != nil {
+		slog.Error(fmt.Sprintf("get callback error for %s: %v", checkID, err))
+		// доставку повторит любой экземпляр, когда истечёт аренда
+		return
+	}
+	if callback.URL == "" {
+		w.finish(ctx, checkID, false)
+		return
+	}
+
+	var key []byte
+	if len(callback.Secret) > 0 {
+		key, err = w.box.Decrypt(callback.Secret)
+		if err != nil {
+			slog.Error(fmt.Sprintf("unable to decrypt callback secret for %s: %v", checkID, err))
+			w.finish(ctx, checkID, false)
+			return
+		}
+	}
+
+	summary, err := w.repo.GetSummary(ctx, checkID.String())
+	if err != nil {
+		slog.Error(fmt.Sprintf("webhook summary error for %s: %v", checkID, err))
+		// доставку повторит любой экземпляр, когда истечёт аренда
+		return
+	}
+	body, err := json.Marshal(summarize(summary))
+	if err != nil {
+		slog.Error(fmt.Sprintf("webhook payload error for %s: %v", checkID, err))
+		w.finish(ctx, checkID, false)
+		return
+	}
+
+	result := w.send(ctx, callback.URL, key, body, delivery.Attempt)
+	if ctx.Err() != nil {
+		// попытку прервала остановка экземпляра, а не получатель: не считаем её и возвращаем доставку в очередь
+		w.release(checkID)
+		return
+	}
+
+	result.CheckID = checkID
+	if err := w.repo.SaveWebhookAttempt(ctx, result); err != nil {
+		slog.Error(fmt.Sprintf("save webhook attempt error: %v", err))
+	}
+
+	switch {
+	case result.Error == "":
+		w.finish(ctx, checkID, true)
+	case delivery.Attempt >= w.maxAttempts:
+		slog.Error(fmt.Sprintf("webhook for %s not delivered after %d attempts: %s", checkID, delivery.Attempt, result.Error))
+		w.finish(ctx, checkID, false)
+	default:
+		slog.Warn(fmt.Sprintf("webhook attempt %d/%d for %s failed: %s", delivery.Attempt, w.maxAttempts, checkID, result.Error))
+		delay := w.backoff << (delivery.Attempt - 1)
+		if err := w.repo.RetryWebhook(ctx, checkID, delay); err != nil {
+			slog.Error(fmt.Sprintf("schedule webhook retry error for %s: %v", checkID, err))
+		}
+	}
+}
+
+// finish снимает доставку с очереди: она доставлена или доставлять больше нечего
+func (w *webhookSender) finish(ctx context.Context, checkID uuid.UUID, delivered bool) {
+	if err := w.repo.FinishWebhook(ctx, checkID, delivered); err != nil {
+		slog.Error(fmt.Sprintf("finish webhook error for %s: %v", checkID, err))
+	}
+}
+
+// release сразу возвращает доставку в очередь, не дожидаясь конца аренды
+func (w *webhookSender) release(checkID uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookReleaseTimeout)
+	defer cancel()
+
+	if err := w.repo.RetryWebhook(ctx, checkID, 0); err != nil {
+		slog.Error(fmt.Sprintf("release webhook error for %s: %v", checkID, err))
+	}
+}
+
+// send делает одну попытку; успехом считается только ответ 2xx
+func (w *webhookSender) send(ctx context.Context, callbackURL string, key, body []byte, attempt int) models.WebhookAttempt {
+	result := models.WebhookAttempt{Attempt: attempt, URL: callbackURL}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, models.EventDone)
+	req.Header.Set(webhookAttemptHeader, fmt.Sprint(attempt))
+	if key != nil {
+		req.Header.Set(webhookSignatureHeader, "sha256="+sign(key, body))
+	}
+
+	start := time.Now()
+	resp, err := w.client.Do(req)
+	result.DurationMs = int(time.Since(start).Milliseconds())
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	result.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		result.Error = resp.Status
+	}
+	return result
+}
+
+func sign(key, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}